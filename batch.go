@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// The imports of the wrappers in the batch file
+var batchFileImports = []string{
+	"context",
+	"errors",
+	"go.opentelemetry.io/otel/attribute",
+	"go.opentelemetry.io/otel/codes",
+	"go.opentelemetry.io/otel/metric",
+	"go.opentelemetry.io/otel/trace",
+	"time",
+}
+
+// The name of the batches in the metric names, taking the place of the query
+const batchMetricName = "batch"
+
+// The type keeping the instruments and attributes of a batch from queueing its queries until its results are drained
+const batchMetricsType = "batchMetrics"
+
+// The field of the batch results holding their batchMetrics
+const batchMetricsField = "metrics"
+
+// The methods of the batch results that drain them, calling a callback for every queued query
+var batchDrainMethods = map[string]bool{
+	"Exec":     true,
+	"Query":    true,
+	"QueryRow": true,
+}
+
+// The method of the batch results that closes them, possibly before they were drained
+const batchCloseMethod = "Close"
+
+// The metrics of the batches enabled for the package. The batches of all queries share their instruments, so like the
+// instruments of the transactions they follow the package settings, not the ones of single queries.
+type batchOptions struct {
+	// The size of the batches and their successful queries are counted like the calls of a query
+	InvocationMetrics bool
+	ErrorMetrics      bool
+	// The duration of the batches is recorded like the runtime of a query
+	RuntimeMetrics bool
+	Traces         bool
+}
+
+func newBatchOptions(options *packageOptions) batchOptions {
+	s := options.settings
+	return batchOptions{
+		InvocationMetrics: s.InvocationMetrics != nil && *s.InvocationMetrics,
+		ErrorMetrics:      s.ErrorMetrics != nil && *s.ErrorMetrics,
+		RuntimeMetrics:    s.RuntimeMetrics != nil && *s.RuntimeMetrics,
+		Traces:            options.traces(),
+	}
+}
+
+// Returns the instruments of the batches enabled for the package, shared by all batch queries of the package
+func batchInstruments(options *packageOptions) []packageInstrument {
+	batch := newBatchOptions(options)
+	var instruments []packageInstrument
+	if batch.InvocationMetrics {
+		instruments = append(instruments, packageInstrument{"batchSizeHistogram", "Int64Histogram", []string{"size", "histogram"}, "{query}", "Queries queued per batch"})
+	}
+	if batch.RuntimeMetrics {
+		instruments = append(instruments, packageInstrument{"batchDurationHistogram", "Float64Histogram", []string{"duration", "histogram"}, "s", "Duration of the batches from queueing their queries until their results are drained or closed"})
+	}
+	if batch.InvocationMetrics {
+		instruments = append(instruments, packageInstrument{"batchSuccessCounter", "Int64Counter", []string{"success", "counter"}, "{query}", "Queued queries of the batches that succeeded"})
+	}
+	if batch.ErrorMetrics {
+		instruments = append(instruments, packageInstrument{"batchErrorCounter", "Int64Counter", []string{"error", "counter"}, "{query}", "Queued queries of the batches that failed"})
+	}
+	return instruments
+}
+
+// Returns the name of the batch query whose results the method drains, or an empty string if it is no drain method
+func batchDrainQuery(FuncDecl *ast.FuncDecl) string {
+	if FuncDecl.Recv == nil || !batchDrainMethods[strings.TrimSuffix(setExported(FuncDecl.Name.Name), "Original")] {
+		return ""
+	}
+	return batchResultsQuery(FuncDecl)
+}
+
+// Returns the name of the batch query whose results the method closes, or an empty string if it is no close method
+func batchCloseQuery(FuncDecl *ast.FuncDecl) string {
+	if FuncDecl.Recv == nil || strings.TrimSuffix(setExported(FuncDecl.Name.Name), "Original") != batchCloseMethod {
+		return ""
+	}
+	return batchResultsQuery(FuncDecl)
+}
+
+// Returns the name of the batch query the results the method belongs to are returned by, or an empty string if it is
+// no method of batch results
+func batchResultsQuery(FuncDecl *ast.FuncDecl) string {
+	if FuncDecl.Recv == nil || len(FuncDecl.Recv.List) != 1 {
+		return ""
+	}
+	StarExpr, ok := FuncDecl.Recv.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return ""
+	}
+	Ident, ok := StarExpr.X.(*ast.Ident)
+	if !ok || !strings.HasSuffix(Ident.Name, "BatchResults") {
+		return ""
+	}
+	return strings.TrimSuffix(Ident.Name, "BatchResults")
+}
+
+// Returns an error if the function is not a batch query or drain method the generated wrappers can handle
+func validateBatchFunction(fset *token.FileSet, FuncDecl *ast.FuncDecl) error {
+	name := FuncDecl.Name.Name
+	if query := batchDrainQuery(FuncDecl); query != "" {
+		params := FuncDecl.Type.Params.List
+		if len(params) != 1 || len(params[0].Names) != 1 {
+			return newError(unsupportedError, fset.Position(FuncDecl.Pos()), query, "%s has to take a single callback", name)
+		}
+		FuncType, ok := params[0].Type.(*ast.FuncType)
+		if !ok || len(FuncType.Params.List) == 0 || !isIdent(FuncType.Params.List[len(FuncType.Params.List)-1].Type, "error") {
+			return newError(unsupportedError, fset.Position(FuncDecl.Pos()), query, "the callback of %s has to take the error last", name)
+		}
+		return nil
+	}
+	if query := batchCloseQuery(FuncDecl); query != "" {
+		if len(FuncDecl.Type.Params.List) != 0 || len(FuncDecl.Recv.List[0].Names) != 1 || FuncDecl.Type.Results == nil || len(FuncDecl.Type.Results.List) != 1 || !isIdent(FuncDecl.Type.Results.List[0].Type, "error") {
+			return newError(unsupportedError, fset.Position(FuncDecl.Pos()), query, "%s has to take no arguments and return an error", name)
+		}
+		return nil
+	}
+	if FuncDecl.Recv == nil || len(FuncDecl.Recv.List) != 1 || len(FuncDecl.Recv.List[0].Names) != 1 || FuncDecl.Recv.List[0].Names[0].Name != "q" {
+		return nil
+	}
+	params := FuncDecl.Type.Params.List
+	if len(params) != 2 || len(params[0].Names) != 1 || params[0].Names[0].Name != "ctx" || len(params[1].Names) != 1 {
+		return newError(unsupportedError, fset.Position(FuncDecl.Pos()), name, "batch queries have to take ctx context.Context and a slice of arguments")
+	}
+	if _, ok := params[1].Type.(*ast.ArrayType); !ok {
+		return newError(unsupportedError, fset.Position(FuncDecl.Pos()), name, "batch queries have to take ctx context.Context and a slice of arguments")
+	}
+	if FuncDecl.Type.Results == nil || len(FuncDecl.Type.Results.List) != 1 {
+		return newError(unsupportedError, fset.Position(FuncDecl.Pos()), name, "batch queries have to return their batch results")
+	}
+	return nil
+}
+
+// The wrappers of a batch query and of the methods draining and closing its results, which record the batch on the
+// instruments of the Queries
+var batchWrapperTemplate = template.Must(template.New("batch").Parse(`package db
+
+func (q *Queries) {{.Name}}({{.Params}}) (arg0 {{.Results}}) {
+	{{if .Span}}{{.Span}}
+	{{end}}metrics := batchMetrics{q: q, ctx: ctx, attributes: {{.Attributes}}, startTime: time.Now(){{if .Span}}, span: span{{end}}}
+	{{if .Batch.InvocationMetrics}}q.batchSizeHistogram.Record(ctx, int64(len({{.Items}})), metrics.attributes)
+	{{end}}arg0 = q.{{.Original}}(ctx, {{.Items}})
+	arg0.metrics = metrics
+	return arg0
+}
+
+{{with .Drain}}
+func ({{.Receiver}} *{{.Type}}) {{.Name}}({{.Callback}} {{.CallbackType}}) {
+	defer {{.Receiver}}.metrics.finish()
+	{{.Receiver}}.{{.Original}}(func({{.Params}}) {
+		{{.Receiver}}.metrics.recordItem(err)
+		if {{.Callback}} != nil {
+			{{.Callback}}({{.Args}})
+		}
+	})
+}
+{{end}}
+
+{{with .Close}}
+func ({{.Receiver}} *{{.Type}}) Close() error {
+	defer {{.Receiver}}.metrics.finish()
+	return {{.Receiver}}.{{.Original}}()
+}
+{{end}}
+`))
+
+// batchMetrics is the same for every batch query. A batch is finished once, by draining or closing its results,
+// whichever happens first.
+var batchMetricsTemplate = template.Must(template.New("batchMetrics").Parse(`package db
+
+type batchMetrics struct {
+	q          *Queries
+	ctx        context.Context
+	attributes metric.MeasurementOption
+	startTime  time.Time
+	finished   bool
+	{{- if .Traces}}
+	span       trace.Span
+	err        error
+	{{- end}}
+}
+
+func (m *batchMetrics) recordItem(err error) {
+	//The queries of closed results are not run, so they neither succeed nor fail
+	if errors.Is(err, ErrBatchAlreadyClosed) {
+		return
+	}
+	if err != nil {
+		{{- if .Traces}}
+		if m.err == nil {
+			m.err = err
+		}
+		{{- end}}
+		{{- if .ErrorMetrics}}
+		m.q.batchErrorCounter.Add(m.ctx, 1, m.attributes, metric.WithAttributes(attribute.String("error.type", classifyQueryError(err))))
+		{{- end}}
+		return
+	}
+	{{- if .InvocationMetrics}}
+	m.q.batchSuccessCounter.Add(m.ctx, 1, m.attributes)
+	{{- end}}
+}
+
+func (m *batchMetrics) finish() {
+	if m.q == nil || m.finished {
+		return
+	}
+	m.finished = true
+	{{- if .RuntimeMetrics}}
+	m.q.batchDurationHistogram.Record(m.ctx, time.Since(m.startTime).Seconds(), m.attributes)
+	{{- end}}
+	{{- if .Traces}}
+	if m.err != nil {
+		m.span.RecordError(m.err)
+		m.span.SetStatus(codes.Error, m.err.Error())
+	}
+	m.span.End()
+	{{- end}}
+}
+`))
+
+// Instruments the batch queries of the file sqlc generates for :batchexec, :batchmany and :batchone queries. The
+// queueing method records the size of the batch, the drain method the outcome of every queued query, and the drain or
+// close method, whichever is called first, the duration of the whole batch. They are renamed and wrapped like the
+// methods of the query files.
+func modifyBatchFile(fset *token.FileSet, file *ast.File, options *packageOptions) (*ast.File, []string, error) {
+
+	if len(file.Comments) == 0 {
+		return nil, nil, newError(unsupportedError, fset.Position(file.Package), "", "file has no sqlc header comment")
+	}
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok {
+			if err := validateBatchFunction(fset, FuncDecl); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if previouslyModified(file) {
+		stripBatchFile(file)
+	}
+	addModifiedComment(file, options.describe())
+
+	var foundQueries []string
+	addMissingImports(file, batchFileImports)
+	addQuerySources(file, options)
+
+	drains, closes := map[string]*ast.FuncDecl{}, map[string]*ast.FuncDecl{}
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok {
+			if query := batchDrainQuery(FuncDecl); query != "" {
+				drains[query] = FuncDecl
+			}
+			if query := batchCloseQuery(FuncDecl); query != "" {
+				closes[query] = FuncDecl
+			}
+		}
+	}
+
+	var versions, wrappers []ast.Decl
+	for _, decl := range file.Decls {
+		v, err := generateVersionConstants(fset, decl)
+		if err != nil {
+			return nil, nil, err
+		}
+		if v != nil {
+			versions = append(versions, v)
+		}
+		FuncDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || FuncDecl.Recv == nil || len(FuncDecl.Recv.List[0].Names) != 1 || FuncDecl.Recv.List[0].Names[0].Name != "q" || options.query(FuncDecl.Name.Name).Excluded {
+			continue
+		}
+		wrapper, err := wrapBatchQuery(fset, file, FuncDecl, drains[FuncDecl.Name.Name], closes[FuncDecl.Name.Name], options)
+		if err != nil {
+			return nil, nil, err
+		}
+		foundQueries = append(foundQueries, FuncDecl.Name.Name)
+		wrappers = append(wrappers, wrapper...)
+	}
+	file.Decls = append(file.Decls, wrappers...)
+	if len(foundQueries) > 0 {
+		decls, err := parseTemplateDecls(batchMetricsTemplate, newBatchOptions(options))
+		if err != nil {
+			return nil, nil, newError(unsupportedError, fset.Position(file.Package), "", "%w", err)
+		}
+		file.Decls = append(file.Decls, decls...)
+	}
+	file.Decls = append(file.Decls, versions...)
+	//Only keep the imports the wrappers use
+	removeUnusedImports(file, batchFileImports)
+	return file, foundQueries, nil
+}
+
+// Renames the batch query and the methods draining and closing its results and returns their wrappers. The batch
+// results get a field for their batchMetrics, which the query leaves empty for the wrapper to set.
+func wrapBatchQuery(fset *token.FileSet, file *ast.File, FuncDecl, drain, closer *ast.FuncDecl, options *packageOptions) ([]ast.Decl, error) {
+	name := FuncDecl.Name.Name
+	resultsType := name + "BatchResults"
+	//The literal of the batch results sqlc returns lists every field, so it needs a value for the new one
+	var literal *ast.CompositeLit
+	ast.Inspect(FuncDecl.Body, func(node ast.Node) bool {
+		if CompositeLit, ok := node.(*ast.CompositeLit); ok && isIdent(CompositeLit.Type, resultsType) {
+			literal = CompositeLit
+		}
+		return true
+	})
+	var fields *ast.FieldList
+	for _, decl := range file.Decls {
+		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.TYPE {
+			if TypeSpec, ok := GenDecl.Specs[0].(*ast.TypeSpec); ok && TypeSpec.Name.Name == resultsType {
+				if StructType, ok := TypeSpec.Type.(*ast.StructType); ok {
+					fields = StructType.Fields
+				}
+			}
+		}
+	}
+	if literal == nil || fields == nil || drain == nil || closer == nil {
+		return nil, newError(unsupportedError, fset.Position(FuncDecl.Pos()), name, "batch query has no %s struct, literal, drain or close method", resultsType)
+	}
+	metrics := &ast.CompositeLit{
+		Type: &ast.Ident{
+			Name: batchMetricsType,
+		},
+	}
+	if len(literal.Elts) > 0 {
+		if _, ok := literal.Elts[0].(*ast.KeyValueExpr); ok {
+			metrics = nil
+		}
+	}
+	if metrics != nil {
+		literal.Elts = append(literal.Elts, metrics)
+	}
+	fields.List = append(fields.List, &ast.Field{
+		Names: []*ast.Ident{
+			{
+				Name: batchMetricsField,
+			},
+		},
+		Type: &ast.Ident{
+			Name: batchMetricsType,
+		},
+	})
+
+	queryOptions := options.query(name)
+	batch := newBatchOptions(options)
+	data := struct {
+		Name       string
+		Params     string
+		Results    string
+		Attributes string
+		Span       string
+		Items      string
+		Original   string
+		Batch      batchOptions
+		Drain      any
+		Close      any
+	}{
+		Name:     name,
+		Results:  nodeSource(fset, FuncDecl.Type.Results.List[0].Type),
+		Items:    FuncDecl.Type.Params.List[1].Names[0].Name,
+		Original: setUnexported(name) + "Original",
+		Batch:    batch,
+	}
+	//The batch runs within the span started when it is queued, which ends once the batch is finished
+	if batch.Traces {
+		data.Span = nodeSource(token.NewFileSet(), startSpan(name, queryOptions)[0])
+	}
+	//The batches of all queries share their instruments, so they are told apart by the name of the query
+	queryOptions.SharedInstruments, queryOptions.Semconv = true, false
+	var attributes []string
+	for _, attribute := range metricAttributes(name, queryOptions).(*ast.CallExpr).Args {
+		attributes = append(attributes, nodeSource(token.NewFileSet(), attribute))
+	}
+	data.Attributes = "metric.WithAttributes(" + strings.Join(attributes, ", ") + ")"
+	//The attributes from the context come first, so the generated ones take precedence if a key is used by both
+	if queryOptions.ContextAttributes {
+		data.Attributes = "metric.WithAttributes(append(q.attributeExtractor(ctx, " + strconv.Quote(name) + "), " + strings.Join(attributes, ", ") + ")...)"
+	}
+	var params []string
+	for _, field := range FuncDecl.Type.Params.List {
+		params = append(params, field.Names[0].Name+" "+nodeSource(fset, field.Type))
+	}
+	data.Params = strings.Join(params, ", ")
+
+	callback := drain.Type.Params.List[0]
+	var callbackArgs, args []string
+	callbackParams := callback.Type.(*ast.FuncType).Params.List
+	for i, param := range callbackParams {
+		arg := "arg" + strconv.Itoa(i)
+		if i == len(callbackParams)-1 {
+			arg = "err"
+		}
+		callbackArgs = append(callbackArgs, arg+" "+nodeSource(fset, param.Type))
+		args = append(args, arg)
+	}
+	data.Drain = struct {
+		Receiver     string
+		Type         string
+		Name         string
+		Original     string
+		Callback     string
+		CallbackType string
+		Params       string
+		Args         string
+	}{
+		Receiver:     drain.Recv.List[0].Names[0].Name,
+		Type:         resultsType,
+		Name:         drain.Name.Name,
+		Original:     setUnexported(drain.Name.Name) + "Original",
+		Callback:     callback.Names[0].Name,
+		CallbackType: nodeSource(fset, callback.Type),
+		Params:       strings.Join(callbackArgs, ", "),
+		Args:         strings.Join(args, ", "),
+	}
+	data.Close = struct {
+		Receiver string
+		Type     string
+		Original string
+	}{
+		Receiver: closer.Recv.List[0].Names[0].Name,
+		Type:     resultsType,
+		Original: setUnexported(closer.Name.Name) + "Original",
+	}
+
+	FuncDecl.Name.Name = setUnexported(name) + "Original"
+	drain.Name.Name = setUnexported(drain.Name.Name) + "Original"
+	closer.Name.Name = setUnexported(closer.Name.Name) + "Original"
+
+	decls, err := parseTemplateDecls(batchWrapperTemplate, data)
+	if err != nil {
+		return nil, newError(unsupportedError, fset.Position(FuncDecl.Pos()), name, "%w", err)
+	}
+	return decls, nil
+}
+
+// Returns the source of a node, to use it within a template
+func nodeSource(fset *token.FileSet, node ast.Node) string {
+	var source bytes.Buffer
+	printerConfig.Fprint(&source, fset, node)
+	return source.String()
+}
+
+// Removes everything modifyBatchFile added, leaving the file as sqlc generated it
+func stripBatchFile(file *ast.File) {
+	removeFunctions(file, func(FuncDecl *ast.FuncDecl) bool {
+		if FuncDecl.Recv == nil {
+			return false
+		}
+		StarExpr, ok := FuncDecl.Recv.List[0].Type.(*ast.StarExpr)
+		return ok && isIdent(StarExpr.X, batchMetricsType)
+	})
+	var decls []ast.Decl
+	for _, decl := range file.Decls {
+		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.TYPE {
+			TypeSpec, ok := GenDecl.Specs[0].(*ast.TypeSpec)
+			if ok && TypeSpec.Name.Name == batchMetricsType {
+				continue
+			}
+			//The batch results lose their batchMetrics field
+			if StructType, ok := TypeSpec.Type.(*ast.StructType); ok && len(StructType.Fields.List) > 0 {
+				if last := StructType.Fields.List[len(StructType.Fields.List)-1]; isIdent(last.Type, batchMetricsType) {
+					StructType.Fields.List = StructType.Fields.List[:len(StructType.Fields.List)-1]
+					//The line of the removed field would be printed as a blank line
+					clearPositions(StructType)
+				}
+			}
+		}
+		decls = append(decls, decl)
+	}
+	file.Decls = decls
+	ast.Inspect(file, func(node ast.Node) bool {
+		if CompositeLit, ok := node.(*ast.CompositeLit); ok && len(CompositeLit.Elts) > 0 {
+			if last, ok := CompositeLit.Elts[len(CompositeLit.Elts)-1].(*ast.CompositeLit); ok && isIdent(last.Type, batchMetricsType) {
+				CompositeLit.Elts = CompositeLit.Elts[:len(CompositeLit.Elts)-1]
+			}
+		}
+		return true
+	})
+
+	//Every batch results type has its own drain and close methods, so their wrappers are found by their receiver
+	originals := map[string]bool{}
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && strings.HasSuffix(FuncDecl.Name.Name, "Original") {
+			if query := batchResultsQuery(FuncDecl); query != "" {
+				originals[query+"."+FuncDecl.Name.Name] = true
+			}
+		}
+	}
+	removeFunctions(file, func(FuncDecl *ast.FuncDecl) bool {
+		query := batchResultsQuery(FuncDecl)
+		return query != "" && originals[query+"."+setUnexported(FuncDecl.Name.Name)+"Original"]
+	})
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && originals[batchResultsQuery(FuncDecl)+"."+FuncDecl.Name.Name] {
+			FuncDecl.Name.Name = setExported(strings.TrimSuffix(FuncDecl.Name.Name, "Original"))
+		}
+	}
+
+	//The wrappers of the queries, the version constants and the imports are removed like the ones of a query file
+	stripQuerySqlFile(file)
+}
+
+// Checks that the batch file is instrumented with the given options and returns the instrumented batch queries
+func checkBatchFile(fset *token.FileSet, file *ast.File, options *packageOptions) ([]error, []string, error) {
+	var problems []error
+	var foundQueries []string
+
+	if !previouslyModified(file) {
+		problems = append(problems, newError(checkError, fset.Position(file.Package), "", "file is not instrumented"))
+	} else if recorded := modifiedOptions(file); !slices.Equal(recorded, options.describe()) {
+		problems = append(problems, newError(checkError, fset.Position(file.Package), "", "file is instrumented with options %q, expected %q", strings.Join(recorded, " "), strings.Join(options.describe(), " ")))
+	}
+	addQuerySources(file, options)
+
+	functions := map[string]bool{}
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && FuncDecl.Recv != nil {
+			functions[batchResultsQuery(FuncDecl)+"."+FuncDecl.Name.Name] = true
+		}
+	}
+	for _, decl := range file.Decls {
+		FuncDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || FuncDecl.Recv == nil || strings.HasSuffix(FuncDecl.Name.Name, "Original") {
+			continue
+		}
+		results := batchDrainQuery(FuncDecl)
+		if results == "" {
+			results = batchCloseQuery(FuncDecl)
+		}
+		if results == "" && (len(FuncDecl.Recv.List[0].Names) != 1 || FuncDecl.Recv.List[0].Names[0].Name != "q") {
+			continue
+		}
+		if functions[results+"."+setUnexported(FuncDecl.Name.Name)+"Original"] {
+			if results == "" {
+				foundQueries = append(foundQueries, FuncDecl.Name.Name)
+			}
+			continue
+		}
+		query := FuncDecl.Name.Name
+		if results != "" {
+			query = results
+		}
+		if options.query(query).Excluded {
+			continue
+		}
+		problems = append(problems, newError(checkError, fset.Position(FuncDecl.Pos()), query, "batch query is not instrumented"))
+	}
+
+	versionProblems, err := checkVersionConstants(fset, file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(problems, versionProblems...), foundQueries, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"slices"
+	"strings"
+)
+
+// Checks that a query file is instrumented with the given options and that the version constants match the queries
+func checkQuerySqlFile(fset *token.FileSet, file *ast.File, options *packageOptions) ([]error, []string, error) {
+	var problems []error
+	var foundFunctions []string
+
+	if !previouslyModified(file) {
+		problems = append(problems, newError(checkError, fset.Position(file.Package), "", "file is not instrumented"))
+	} else if recorded := modifiedOptions(file); !slices.Equal(recorded, options.describe()) {
+		problems = append(problems, newError(checkError, fset.Position(file.Package), "", "file is instrumented with options %q, expected %q", strings.Join(recorded, " "), strings.Join(options.describe(), " ")))
+	}
+
+	//The kinds of the queries decide which instruments the db file needs
+	addQuerySources(file, options)
+
+	functions := map[string]*ast.FuncDecl{}
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && FuncDecl.Recv != nil {
+			functions[FuncDecl.Name.Name] = FuncDecl
+		}
+	}
+
+	//Every query method needs to be renamed and wrapped
+	for _, decl := range file.Decls {
+		FuncDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || FuncDecl.Recv == nil {
+			continue
+		}
+		name := FuncDecl.Name.Name
+		if strings.HasSuffix(name, "Original") {
+			wrapper := setExported(strings.TrimSuffix(name, "Original"))
+			if _, ok := functions[wrapper]; !ok {
+				problems = append(problems, newError(checkError, fset.Position(FuncDecl.Pos()), wrapper, "wrapper is missing"))
+			}
+			continue
+		}
+		if _, ok := functions[setUnexported(name)+"Original"]; ok {
+			foundFunctions = append(foundFunctions, name)
+			continue
+		}
+		if options.query(name).Excluded {
+			continue
+		}
+		problems = append(problems, newError(checkError, fset.Position(FuncDecl.Pos()), name, "query is not instrumented"))
+	}
+
+	//Every query needs a version constant matching the current sql
+	versionProblems, err := checkVersionConstants(fset, file)
+	if err != nil {
+		return nil, nil, err
+	}
+	problems = append(problems, versionProblems...)
+
+	return problems, foundFunctions, nil
+}
+
+// Checks that every query of the file has a version constant matching its current sql
+func checkVersionConstants(fset *token.FileSet, file *ast.File) ([]error, error) {
+	var problems []error
+	constants := map[string]*ast.ValueSpec{}
+	for _, decl := range file.Decls {
+		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.CONST {
+			for _, spec := range GenDecl.Specs {
+				ValueSpec := spec.(*ast.ValueSpec)
+				constants[ValueSpec.Names[0].Name] = ValueSpec
+			}
+		}
+	}
+	for _, decl := range file.Decls {
+		GenDecl, ok := decl.(*ast.GenDecl)
+		if !ok || GenDecl.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range GenDecl.Specs {
+			ValueSpec := spec.(*ast.ValueSpec)
+			name := ValueSpec.Names[0].Name
+			if _, ok := constants[strings.TrimSuffix(name, "Version")]; ok && strings.HasSuffix(name, "Version") {
+				continue
+			}
+			//Constants without a value, like the ones following an iota, are no queries
+			if len(ValueSpec.Values) == 0 {
+				continue
+			}
+			BasicLit, ok := ValueSpec.Values[0].(*ast.BasicLit)
+			if !ok || BasicLit.Kind != token.STRING {
+				continue
+			}
+			query := setExported(name)
+			versionSpec, ok := constants[name+"Version"]
+			if !ok {
+				problems = append(problems, newError(checkError, fset.Position(ValueSpec.Pos()), query, "version constant is missing"))
+				continue
+			}
+			version, err := queryVersion(BasicLit.Value)
+			if err != nil {
+				return nil, newError(unsupportedError, fset.Position(ValueSpec.Pos()), query, "version can not be computed: %w", err)
+			}
+			if recordedVersion(versionSpec) != "\""+version+"\"" {
+				problems = append(problems, newError(checkError, fset.Position(versionSpec.Pos()), query, "version constant does not match the query"))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// Returns the literal a version constant is set to, or an empty string if it is not set to a literal
+func recordedVersion(ValueSpec *ast.ValueSpec) string {
+	if len(ValueSpec.Values) == 0 {
+		return ""
+	}
+	if BasicLit, ok := ValueSpec.Values[0].(*ast.BasicLit); ok {
+		return BasicLit.Value
+	}
+	return ""
+}
+
+// Checks that the db file is instrumented with the given options and that the Queries struct has a metric for every
+// instrumented query
+func checkDbFile(fset *token.FileSet, file *ast.File, foundFunctions, batchQueries []string, options *packageOptions) []error {
+	var problems []error
+
+	if !previouslyModified(file) {
+		return append(problems, newError(checkError, fset.Position(file.Package), "", "file is not instrumented"))
+	}
+	if recorded := modifiedOptions(file); !slices.Equal(recorded, options.describe()) {
+		problems = append(problems, newError(checkError, fset.Position(file.Package), "", "file is instrumented with options %q, expected %q", strings.Join(recorded, " "), strings.Join(options.describe(), " ")))
+	}
+
+	fields := map[string]bool{}
+	queriesPos := file.Package
+	for _, decl := range file.Decls {
+		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.TYPE {
+			if TypeSpec, ok := GenDecl.Specs[0].(*ast.TypeSpec); ok && TypeSpec.Name.Name == "Queries" {
+				queriesPos = TypeSpec.Pos()
+				for _, field := range TypeSpec.Type.(*ast.StructType).Fields.List {
+					for _, name := range field.Names {
+						fields[name.Name] = true
+					}
+				}
+			}
+		}
+	}
+
+	//A WithTx that creates a new Queries loses the instruments
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && FuncDecl.Recv != nil && FuncDecl.Name.Name == "WithTx" && len(FuncDecl.Body.List) == 1 {
+			problems = append(problems, newError(checkError, fset.Position(FuncDecl.Pos()), "", "WithTx does not copy the instruments"))
+		}
+	}
+
+	if options.txHelper() {
+		found := false
+		for _, decl := range file.Decls {
+			if FuncDecl, ok := decl.(*ast.FuncDecl); ok && FuncDecl.Recv != nil && FuncDecl.Name.Name == "RunInTx" {
+				found = true
+			}
+		}
+		if !found {
+			problems = append(problems, newError(checkError, fset.Position(file.Package), "", "RunInTx function is missing"))
+		}
+	}
+
+	//Prepare records the preparation of the statements with prepareStatement
+	if findPrepare(file) != nil {
+		found := false
+		for _, decl := range file.Decls {
+			if FuncDecl, ok := decl.(*ast.FuncDecl); ok && FuncDecl.Recv != nil && FuncDecl.Name.Name == prepareStatementFunction {
+				found = true
+			}
+		}
+		if !found {
+			problems = append(problems, newError(checkError, fset.Position(file.Package), "", "%s function is missing", prepareStatementFunction))
+		}
+	}
+
+	if usesClassifyError(foundFunctions, options) || findPrepare(file) != nil || (len(batchQueries) > 0 && newBatchOptions(options).ErrorMetrics) {
+		found := false
+		for _, decl := range file.Decls {
+			if FuncDecl, ok := decl.(*ast.FuncDecl); ok && FuncDecl.Recv == nil && FuncDecl.Name.Name == classifyErrorFunction {
+				found = true
+			}
+		}
+		if !found {
+			problems = append(problems, newError(checkError, fset.Position(file.Package), "", "%s function is missing", classifyErrorFunction))
+		}
+	}
+
+	for _, function := range foundFunctions {
+		queryOptions := options.query(function)
+		var suffixes []string
+		if queryOptions.RuntimeMetrics {
+			suffixes = append(suffixes, "RuntimeHistogram")
+		}
+		if queryOptions.RuntimeMetrics && queryOptions.RuntimeGauge {
+			suffixes = append(suffixes, "RuntimeGauge")
+		}
+		if queryOptions.InvocationMetrics {
+			suffixes = append(suffixes, "InvocationCounter")
+		}
+		if queryOptions.ErrorMetrics {
+			suffixes = append(suffixes, "ErrorCounter")
+		}
+		if queryOptions.rowMetrics() {
+			suffixes = append(suffixes, "RowsHistogram")
+		}
+		if queryOptions.inputRowMetrics() {
+			suffixes = append(suffixes, "InputRowsHistogram")
+		}
+		if queryOptions.InFlightMetrics {
+			suffixes = append(suffixes, "InFlightCounter")
+		}
+		for _, suffix := range suffixes {
+			if field := queryOptions.field(function, suffix); !fields[field] {
+				problems = append(problems, newError(checkError, fset.Position(queriesPos), function, "Queries struct has no %s field", field))
+			}
+		}
+	}
+	if len(batchQueries) > 0 {
+		for _, instrument := range batchInstruments(options) {
+			if !fields[instrument.field] {
+				problems = append(problems, newError(checkError, fset.Position(queriesPos), "", "Queries struct has no %s field", instrument.field))
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A problem the check is expected to report
+type wantProblem struct {
+	file    string
+	query   string
+	message string
+}
+
+func TestCheck(t *testing.T) {
+	withoutTraces := pgxFlags()
+	withoutTraces.Traces = nil
+	tests := []struct {
+		name    string
+		fixture string
+		// Replaces old with new in the file before checking it
+		file, old, new string
+		flags          settings
+		want           []wantProblem
+	}{
+		{"instrumented", "golden/pgx", "", "", "", pgxFlags(), nil},
+		{
+			"edited query",
+			"golden/pgx", "users.sql.go", "WHERE id = $1 LIMIT 1", "WHERE id = $1",
+			pgxFlags(),
+			[]wantProblem{{"users.sql.go", "GetAuthorByID", "version constant does not match the query"}},
+		},
+		{
+			"removed version constant",
+			"golden/pgx", "orders.sql.go", "const deleteOrdersForAuthorVersion", "var deleteOrdersForAuthorVersion",
+			pgxFlags(),
+			[]wantProblem{{"orders.sql.go", "DeleteOrdersForAuthor", "version constant is missing"}},
+		},
+		{
+			"other options",
+			"golden/pgx", "", "", "",
+			withoutTraces,
+			[]wantProblem{
+				{"orders.sql.go", "", "file is instrumented with options"},
+				{"users.sql.go", "", "file is instrumented with options"},
+				{"batch.go", "", "file is instrumented with options"},
+				{"copyfrom.go", "", "file is instrumented with options"},
+				{"db.go", "", "file is instrumented with options"},
+			},
+		},
+		{
+			"missing marker",
+			"golden/pgx", "orders.sql.go", "// Modified by sqlc-metrics-generator", "// Modified by hand",
+			pgxFlags(),
+			[]wantProblem{{"orders.sql.go", "", "file is not instrumented"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			copyFixtures(t, dir, test.fixture)
+			if test.file != "" {
+				filename := filepath.Join(dir, test.file)
+				content, err := os.ReadFile(filename)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Contains(content, []byte(test.old)) {
+					t.Fatalf("%s does not contain %q", test.file, test.old)
+				}
+				if err := os.WriteFile(filename, bytes.Replace(content, []byte(test.old), []byte(test.new), 1), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			outputs, problems := processDir(t, dir, test.flags, true, false)
+			if len(outputs) > 0 {
+				t.Errorf("check returned %d files to write", len(outputs))
+			}
+			if len(problems) != len(test.want) {
+				t.Fatalf("check found %d problems, want %d: %v", len(problems), len(test.want), problems)
+			}
+			for i, problem := range problems {
+				var generatorErr *generatorError
+				if !errors.As(problem, &generatorErr) {
+					t.Fatalf("problem %v is no generatorError", problem)
+				}
+				want := test.want[i]
+				if generatorErr.Kind != checkError || filepath.Base(generatorErr.Position.Filename) != want.file || generatorErr.Query != want.query || !strings.Contains(generatorErr.Err.Error(), want.message) {
+					t.Errorf("problem %d = %v, want %s: %s: %s", i, problem, want.file, want.query, want.message)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckReport(t *testing.T) {
+	dir := t.TempDir()
+	copyFixtures(t, dir, "pgx")
+	_, problems := processDir(t, dir, pgxFlags(), true, false)
+	if len(problems) == 0 {
+		t.Fatal("check of the uninstrumented package found no problems")
+	}
+
+	var text bytes.Buffer
+	if code := reportErrors(&text, "text", problems); code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if lines := strings.Split(strings.TrimSuffix(text.String(), "\n"), "\n"); len(lines) != len(problems) {
+		t.Errorf("text report has %d lines, want one per problem:\n%s", len(lines), text.String())
+	}
+
+	var output bytes.Buffer
+	if code := reportErrors(&output, "json", problems); code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	var report struct {
+		Diagnostics []struct {
+			Kind    string `json:"kind"`
+			File    string `json:"file"`
+			Line    int    `json:"line"`
+			Query   string `json:"query"`
+			Message string `json:"message"`
+		} `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(output.Bytes(), &report); err != nil {
+		t.Fatalf("json report can not be decoded: %v\n%s", err, output.String())
+	}
+	if len(report.Diagnostics) != len(problems) {
+		t.Fatalf("json report has %d diagnostics, want %d", len(report.Diagnostics), len(problems))
+	}
+	first := report.Diagnostics[0]
+	if first.Kind != "check" || first.File != filepath.Join(dir, "orders.sql.go") || first.Line == 0 || first.Message != "file is not instrumented" {
+		t.Errorf("first diagnostic = %+v, want the first query file that is not instrumented", first)
+	}
+
+	//Without problems the check passes
+	output.Reset()
+	if code := reportErrors(&output, "json", nil); code != 0 || strings.TrimSpace(output.String()) != `{
+  "diagnostics": []
+}` {
+		t.Errorf("report without problems = %d, %s", code, output.String())
+	}
+}
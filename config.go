@@ -0,0 +1,632 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Names of the config file, which is looked up next to the sqlc config if not passed via -config
+var configFilenames = []string{"sqlc-metrics.yaml", "sqlc-metrics.yml", "sqlc-metrics.json"}
+
+// The bucket boundaries of the runtime histogram in seconds if none are configured, as recommended by the OpenTelemetry
+// semantic conventions for durations
+var defaultRuntimeBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+// Names of the sqlc config file
+var sqlcConfigFilenames = []string{"sqlc.yaml", "sqlc.yml", "sqlc.json"}
+
+// The config file. Since JSON is valid YAML, both formats are read by the same parser.
+type config struct {
+	// Applied to every package and query
+	Defaults settings `yaml:"defaults"`
+	// Overrides for the sqlc output packages, keyed by their path relative to the config file
+	Packages map[string]packageSettings `yaml:"packages"`
+
+	// The directory of the config file, package paths are relative to it
+	dir string
+}
+
+type packageSettings struct {
+	settings `yaml:",inline"`
+	// Overrides for single queries, keyed by the name of the query
+	Queries map[string]settings `yaml:"queries"`
+}
+
+// Settings that can be set globally, per package and per query. Unset values are inherited from the enclosing level.
+type settings struct {
+	InvocationMetrics *bool `yaml:"invocationMetrics"`
+	ErrorMetrics      *bool `yaml:"errorMetrics"`
+	RuntimeMetrics    *bool `yaml:"runtimeMetrics"`
+	// Records the number of rows returned or affected by :many, :execrows and :execresult queries
+	RowMetrics *bool `yaml:"rowMetrics"`
+	// Counts the calls of the queries that have not returned yet
+	InFlightMetrics *bool `yaml:"inFlightMetrics"`
+	// Does not count errors that only mean the query returned no rows
+	ExcludeNoRows *bool `yaml:"excludeNoRowsErrors"`
+	// The bucket boundaries of the runtime histogram in seconds
+	RuntimeBuckets []float64 `yaml:"runtimeBuckets"`
+	// Additionally records the runtime on the gauge used before the histogram, to keep existing dashboards working
+	RuntimeGauge *bool `yaml:"runtimeGauge"`
+	// Records every query on the same instruments, distinguished by the db.query.name attribute. Only applies to
+	// packages.
+	SharedInstruments *bool `yaml:"sharedInstruments"`
+	// Follows the OpenTelemetry database semantic conventions, implies sharedInstruments. Only applies to packages.
+	Semconv *bool `yaml:"semconv"`
+	// Only applies to packages
+	ConnectionRetriever *bool `yaml:"connectionRetriever"`
+	// Adds a parameter to New for a function returning attributes from the context of a query, only applies to
+	// packages
+	AttributeExtractor *bool `yaml:"attributeExtractor"`
+	// Starts a span for every call of a query with the tracer provider passed to New, only applies to packages
+	Traces *bool `yaml:"traces"`
+	// Generates RunInTx, which records metrics of the transactions it runs, only applies to packages
+	TxHelper *bool `yaml:"txHelper"`
+	// How often RunInTx retries a transaction after a serialization failure, only applies to packages
+	TxRetries *int `yaml:"txRetries"`
+	// The basename New uses if none is passed, only applies to packages
+	Basename *string `yaml:"basename"`
+	// The name of the query within the metric names, only applies to queries
+	Name *string `yaml:"name"`
+	// Additional constant attributes recorded with every metric
+	Attributes map[string]string `yaml:"attributes"`
+	// The template the metric names are built from and the separator it uses, only apply to packages
+	NameTemplate *string `yaml:"nameTemplate"`
+	Separator    *string `yaml:"separator"`
+	// The description of the instruments of the query, only applies to queries
+	Description *string `yaml:"description"`
+	// Excludes the query from being instrumented
+	Exclude *bool `yaml:"exclude"`
+}
+
+// Overrides every value that is set in other
+func (s settings) merge(other settings) settings {
+	if other.InvocationMetrics != nil {
+		s.InvocationMetrics = other.InvocationMetrics
+	}
+	if other.ErrorMetrics != nil {
+		s.ErrorMetrics = other.ErrorMetrics
+	}
+	if other.RuntimeMetrics != nil {
+		s.RuntimeMetrics = other.RuntimeMetrics
+	}
+	if other.RowMetrics != nil {
+		s.RowMetrics = other.RowMetrics
+	}
+	if other.InFlightMetrics != nil {
+		s.InFlightMetrics = other.InFlightMetrics
+	}
+	if other.ExcludeNoRows != nil {
+		s.ExcludeNoRows = other.ExcludeNoRows
+	}
+	if other.RuntimeBuckets != nil {
+		s.RuntimeBuckets = other.RuntimeBuckets
+	}
+	if other.RuntimeGauge != nil {
+		s.RuntimeGauge = other.RuntimeGauge
+	}
+	if other.SharedInstruments != nil {
+		s.SharedInstruments = other.SharedInstruments
+	}
+	if other.Semconv != nil {
+		s.Semconv = other.Semconv
+	}
+	if other.ConnectionRetriever != nil {
+		s.ConnectionRetriever = other.ConnectionRetriever
+	}
+	if other.AttributeExtractor != nil {
+		s.AttributeExtractor = other.AttributeExtractor
+	}
+	if other.Traces != nil {
+		s.Traces = other.Traces
+	}
+	if other.TxHelper != nil {
+		s.TxHelper = other.TxHelper
+	}
+	if other.TxRetries != nil {
+		s.TxRetries = other.TxRetries
+	}
+	if other.Basename != nil {
+		s.Basename = other.Basename
+	}
+	if other.Name != nil {
+		s.Name = other.Name
+	}
+	if other.NameTemplate != nil {
+		s.NameTemplate = other.NameTemplate
+	}
+	if other.Separator != nil {
+		s.Separator = other.Separator
+	}
+	if other.Description != nil {
+		s.Description = other.Description
+	}
+	if other.Exclude != nil {
+		s.Exclude = other.Exclude
+	}
+	if len(other.Attributes) > 0 {
+		attributes := map[string]string{}
+		for key, value := range s.Attributes {
+			attributes[key] = value
+		}
+		for key, value := range other.Attributes {
+			attributes[key] = value
+		}
+		s.Attributes = attributes
+	}
+	return s
+}
+
+// Loads the config file. If filename is empty, the config is looked up next to the sqlc config of the package in
+// path. Returns nil if there is no config file.
+func loadConfig(filename, path string) (*config, error) {
+	if filename == "" {
+		filename = findConfig(path)
+		if filename == "" {
+			return nil, nil
+		}
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fileError(filename, err)
+	}
+	c := &config{}
+	decoder := yaml.NewDecoder(strings.NewReader(string(content)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		return nil, newError(parseError, token.Position{Filename: filename}, "", "%w", err)
+	}
+	c.dir = filepath.Dir(filename)
+	if err := c.validate(filename); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Returns the config file next to the closest sqlc config in path or one of its parents
+func findConfig(path string) string {
+	sqlcConfigFilename := findSqlcConfig(path)
+	if sqlcConfigFilename == "" {
+		return ""
+	}
+	for _, configFilename := range configFilenames {
+		filename := filepath.Join(filepath.Dir(sqlcConfigFilename), configFilename)
+		if _, err := os.Stat(filename); err == nil {
+			return filename
+		}
+	}
+	return ""
+}
+
+// Rejects settings that are set on a level they do not apply to
+func (c *config) validate(filename string) error {
+	invalid := func(level, setting string) error {
+		return newError(usageError, token.Position{Filename: filename}, "", "%s can not be set for %s", setting, level)
+	}
+	if c.Defaults.Name != nil {
+		return invalid("defaults", "name")
+	}
+	if c.Defaults.Description != nil {
+		return invalid("defaults", "description")
+	}
+	if err := c.Defaults.validate(); err != nil {
+		return newError(usageError, token.Position{Filename: filename}, "", "defaults: %w", err)
+	}
+	for path, p := range c.Packages {
+		if p.Name != nil {
+			return invalid("package "+path, "name")
+		}
+		if p.Description != nil {
+			return invalid("package "+path, "description")
+		}
+		if err := p.settings.validate(); err != nil {
+			return newError(usageError, token.Position{Filename: filename}, "", "package %s: %w", path, err)
+		}
+		for query, q := range p.Queries {
+			if err := q.validate(); err != nil {
+				return newError(usageError, token.Position{Filename: filename}, "", "query %s: %w", query, err)
+			}
+			if q.ConnectionRetriever != nil {
+				return invalid("query "+query, "connectionRetriever")
+			}
+			if q.Basename != nil {
+				return invalid("query "+query, "basename")
+			}
+			if q.AttributeExtractor != nil {
+				return invalid("query "+query, "attributeExtractor")
+			}
+			if q.Traces != nil {
+				return invalid("query "+query, "traces")
+			}
+			if q.TxHelper != nil {
+				return invalid("query "+query, "txHelper")
+			}
+			if q.TxRetries != nil {
+				return invalid("query "+query, "txRetries")
+			}
+			if q.SharedInstruments != nil {
+				return invalid("query "+query, "sharedInstruments")
+			}
+			if q.Semconv != nil {
+				return invalid("query "+query, "semconv")
+			}
+			if q.NameTemplate != nil {
+				return invalid("query "+query, "nameTemplate")
+			}
+			if q.Separator != nil {
+				return invalid("query "+query, "separator")
+			}
+		}
+	}
+	return nil
+}
+
+// Rejects values that can not be used to generate code
+func (s settings) validate() error {
+	if err := validateBuckets(s.RuntimeBuckets); err != nil {
+		return err
+	}
+	if s.NameTemplate != nil {
+		if _, err := parseNameTemplate(*s.NameTemplate); err != nil {
+			return fmt.Errorf("invalid name template: %w", err)
+		}
+	}
+	if s.TxRetries != nil && *s.TxRetries < 0 {
+		return fmt.Errorf("txRetries can not be negative")
+	}
+	if s.Separator != nil {
+		return validateSeparator(*s.Separator)
+	}
+	return nil
+}
+
+// Returns an error if the bucket boundaries are not strictly increasing
+func validateBuckets(buckets []float64) error {
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return fmt.Errorf("runtime buckets have to be strictly increasing, %v follows %v", buckets[i], buckets[i-1])
+		}
+	}
+	return nil
+}
+
+// Returns the settings for the package in path
+func (c *config) packageSettings(path string) packageSettings {
+	if c == nil {
+		return packageSettings{}
+	}
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return packageSettings{}
+	}
+	configDir, err := filepath.Abs(c.dir)
+	if err != nil {
+		return packageSettings{}
+	}
+	for key, p := range c.Packages {
+		if filepath.Join(configDir, filepath.FromSlash(key)) == dir {
+			return p
+		}
+	}
+	return packageSettings{}
+}
+
+// The options a package is instrumented with, resolved from the config file and the command line flags
+type packageOptions struct {
+	// The resolved package level settings
+	settings settings
+	// The per query overrides
+	queries map[string]settings
+	// The settings passed as command line flags, they override the config file on every level
+	flags settings
+	// Hash of the settings taken from the config file, if one is used
+	configHash string
+	// The settings of the package in the sqlc config, if one is used
+	sqlc sqlcPackage
+	// The sql and doc comment of every query, collected from the query files
+	sources map[string]querySource
+}
+
+// The parts of a query file that describe a query
+type querySource struct {
+	SQL string
+	Doc string
+}
+
+// The resolved options of a single query
+type queryOptions struct {
+	InvocationMetrics bool
+	ErrorMetrics      bool
+	RuntimeMetrics    bool
+	RowMetrics        bool
+	InFlightMetrics   bool
+	ExcludeNoRows     bool
+	RuntimeBuckets    []float64
+	RuntimeGauge      bool
+	SharedInstruments bool
+	Semconv           bool
+	// Set if the attributes returned by the attribute extractor passed to New are recorded
+	ContextAttributes bool
+	// Set if a span is started for every call
+	Traces bool
+	// Set if the calls within a transaction run by RunInTx are counted
+	TxHelper bool
+	// The kind of the query from its -- name: line, e.g. :many
+	Kind string
+	// The value of db.system.name, taken from the sqlc engine
+	DbSystem string
+	// The operation and the table of the sql query, for the semantic conventions, the table only if there is one
+	Operation  string
+	Collection string
+	// The value of db.query.summary, the operation and all tables of the sql query
+	Summary string
+	// The description of the instruments, the doc comment or the -- name: line of the query by default
+	Description string
+	// The name of the query within the metric names
+	Name string
+	// Set if the name is configured instead of derived from the query
+	NameOverride bool
+	NameTemplate string
+	Separator    string
+	Attributes   map[string]string
+	Excluded     bool
+}
+
+func newPackageOptions(c *config, path string, flags settings) *packageOptions {
+	p := c.packageSettings(path)
+	options := &packageOptions{
+		settings: p.settings,
+		queries:  p.Queries,
+		flags:    flags,
+	}
+	if c != nil {
+		options.settings = c.Defaults.merge(p.settings)
+		content, _ := json.Marshal(packageSettings{settings: options.settings, Queries: options.queries})
+		hash := sha256.Sum256(content)
+		options.configHash = hex.EncodeToString(hash[:4])
+	}
+	options.settings = options.settings.merge(flags)
+	return options
+}
+
+// Returns the options of the named query
+func (p *packageOptions) query(name string) queryOptions {
+	s := p.settings.merge(p.queries[name]).merge(p.flags)
+	options := queryOptions{
+		InvocationMetrics: s.InvocationMetrics != nil && *s.InvocationMetrics,
+		ErrorMetrics:      s.ErrorMetrics != nil && *s.ErrorMetrics,
+		RuntimeMetrics:    s.RuntimeMetrics != nil && *s.RuntimeMetrics,
+		RowMetrics:        s.RowMetrics != nil && *s.RowMetrics,
+		InFlightMetrics:   s.InFlightMetrics != nil && *s.InFlightMetrics,
+		ExcludeNoRows:     s.ExcludeNoRows != nil && *s.ExcludeNoRows,
+		RuntimeBuckets:    defaultRuntimeBuckets,
+		RuntimeGauge:      s.RuntimeGauge != nil && *s.RuntimeGauge,
+		SharedInstruments: p.settings.SharedInstruments != nil && *p.settings.SharedInstruments,
+		Semconv:           p.settings.Semconv != nil && *p.settings.Semconv,
+		ContextAttributes: p.settings.AttributeExtractor != nil && *p.settings.AttributeExtractor,
+		Traces:            p.settings.Traces != nil && *p.settings.Traces,
+		TxHelper:          p.settings.TxHelper != nil && *p.settings.TxHelper,
+		DbSystem:          p.sqlc.Engine,
+		Name:              strings.ToLower(toSnakeCase(name)),
+		Attributes:        s.Attributes,
+		Excluded:          s.Exclude != nil && *s.Exclude,
+	}
+	if s.Name != nil {
+		options.Name = *s.Name
+		options.NameOverride = true
+	}
+	options.NameTemplate = defaultNameTemplate
+	if p.settings.NameTemplate != nil {
+		options.NameTemplate = *p.settings.NameTemplate
+	}
+	options.Separator = "_"
+	if p.settings.Separator != nil {
+		options.Separator = *p.settings.Separator
+	}
+	if s.RuntimeBuckets != nil {
+		options.RuntimeBuckets = s.RuntimeBuckets
+	}
+	if options.DbSystem == "" {
+		options.DbSystem = "postgresql"
+	}
+	source := p.sources[name]
+	operation, tables := parseQuery(source.SQL)
+	options.Operation, options.Summary = operation, querySummary(operation, tables)
+	//A query on several tables has no single collection
+	if len(tables) == 1 {
+		options.Collection = tables[0]
+	}
+	options.Kind = queryKind(source.SQL)
+	options.Description = source.Doc
+	if options.Description == "" {
+		options.Description, _, _ = strings.Cut(source.SQL, "\n")
+	}
+	if s.Description != nil {
+		options.Description = *s.Description
+	}
+	if options.Semconv {
+		options.SharedInstruments = true
+	}
+	//A shared histogram has one set of buckets, so only the package level applies
+	if options.SharedInstruments {
+		options.RuntimeBuckets = defaultRuntimeBuckets
+		if options.Semconv {
+			options.RuntimeBuckets = semconvRuntimeBuckets
+		}
+		if p.settings.RuntimeBuckets != nil {
+			options.RuntimeBuckets = p.settings.RuntimeBuckets
+		}
+	}
+	return options
+}
+
+// Returns the name of the Queries field holding the instrument with the given suffix for the query
+func (q queryOptions) field(function, suffix string) string {
+	if q.SharedInstruments {
+		return setUnexported(suffix)
+	}
+	return setUnexported(function) + suffix
+}
+
+// Returns the description of the instrument of the query. Shared instruments are described by what they measure,
+// since they belong to no single query.
+func (q queryOptions) description(shared string) string {
+	if q.SharedInstruments {
+		return shared
+	}
+	return q.Description
+}
+
+// Returns true if the number of rows is recorded for the query, which is only known for some kinds of queries
+func (q queryOptions) rowMetrics() bool {
+	switch q.Kind {
+	case ":many", ":execrows", ":execresult", ":copyfrom":
+		return q.RowMetrics
+	}
+	return false
+}
+
+// Returns true if the number of rows passed to the query is recorded, which only :copyfrom queries take as a slice
+func (q queryOptions) inputRowMetrics() bool {
+	return q.Kind == ":copyfrom" && q.RowMetrics
+}
+
+// Returns true if the wrapper of the query records any metric
+func (q queryOptions) recordsMetrics() bool {
+	return q.RuntimeMetrics || q.ErrorMetrics || q.InvocationMetrics || q.rowMetrics() || q.InFlightMetrics
+}
+
+func (p *packageOptions) connectionRetriever() bool {
+	return p.settings.ConnectionRetriever != nil && *p.settings.ConnectionRetriever
+}
+
+func (p *packageOptions) attributeExtractor() bool {
+	return p.settings.AttributeExtractor != nil && *p.settings.AttributeExtractor
+}
+
+func (p *packageOptions) traces() bool {
+	return p.settings.Traces != nil && *p.settings.Traces
+}
+
+func (p *packageOptions) txHelper() bool {
+	return p.settings.TxHelper != nil && *p.settings.TxHelper
+}
+
+func (p *packageOptions) txRetries() int {
+	if p.settings.TxRetries != nil {
+		return *p.settings.TxRetries
+	}
+	return 0
+}
+
+func (p *packageOptions) basename() string {
+	if p.settings.Basename != nil {
+		return *p.settings.Basename
+	}
+	return "sqlc"
+}
+
+// Returns true if at least one metric is enabled on the package level or for any query, or traces or the transaction
+// metrics are enabled
+func (p *packageOptions) anyMetricEnabled() bool {
+	if p.traces() || p.txHelper() {
+		return true
+	}
+	for _, s := range append([]settings{p.settings}, queriesSettings(p.queries)...) {
+		s = p.settings.merge(s).merge(p.flags)
+		if (s.InvocationMetrics != nil && *s.InvocationMetrics) || (s.ErrorMetrics != nil && *s.ErrorMetrics) || (s.RuntimeMetrics != nil && *s.RuntimeMetrics) || (s.RowMetrics != nil && *s.RowMetrics) || (s.InFlightMetrics != nil && *s.InFlightMetrics) {
+			return true
+		}
+	}
+	return false
+}
+
+func queriesSettings(queries map[string]settings) []settings {
+	var list []settings
+	for _, s := range queries {
+		list = append(list, s)
+	}
+	return list
+}
+
+// Describes the options as command line flags, so the check mode can detect files instrumented with other options.
+// Everything that can only be set in the config file is covered by the hash of the config file.
+func (p *packageOptions) describe() []string {
+	var options []string
+	enabled := func(value *bool, flag string) {
+		if value != nil && *value {
+			options = append(options, flag)
+		}
+	}
+	enabled(p.settings.InvocationMetrics, "-generateInvocationMetrics")
+	enabled(p.settings.ErrorMetrics, "-generateErrorMetrics")
+	enabled(p.settings.RuntimeMetrics, "-generateQueryRuntimeMetrics")
+	enabled(p.settings.RowMetrics, "-generateRowMetrics")
+	enabled(p.settings.InFlightMetrics, "-generateInFlightMetrics")
+	enabled(p.settings.ExcludeNoRows, "-excludeNoRowsErrors")
+	enabled(p.settings.RuntimeGauge, "-generateRuntimeGauge")
+	enabled(p.settings.SharedInstruments, "-sharedInstruments")
+	enabled(p.settings.Semconv, "-semconv")
+	enabled(p.settings.ConnectionRetriever, "-generateConnectionRetriever")
+	enabled(p.settings.AttributeExtractor, "-generateAttributeExtractor")
+	enabled(p.settings.Traces, "-generateTraces")
+	enabled(p.settings.TxHelper, "-generateTxHelper")
+	if p.settings.TxRetries != nil {
+		options = append(options, "-txRetries="+strconv.Itoa(*p.settings.TxRetries))
+	}
+	if p.settings.RuntimeBuckets != nil {
+		options = append(options, "-runtimeBuckets="+formatBuckets(p.settings.RuntimeBuckets))
+	}
+	//The options are separated by spaces, so they are removed from the template
+	if p.settings.NameTemplate != nil {
+		options = append(options, "-nameTemplate="+strings.Join(strings.Fields(*p.settings.NameTemplate), ""))
+	}
+	if p.settings.Separator != nil {
+		options = append(options, "-separator="+*p.settings.Separator)
+	}
+	if p.configHash != "" {
+		options = append(options, "-config="+p.configHash)
+	}
+	return options
+}
+
+// Formats the bucket boundaries as the comma separated list accepted by -runtimeBuckets
+func formatBuckets(buckets []float64) string {
+	var values []string
+	for _, bucket := range buckets {
+		values = append(values, strconv.FormatFloat(bucket, 'g', -1, 64))
+	}
+	return strings.Join(values, ",")
+}
+
+// Parses the comma separated list of bucket boundaries passed to -runtimeBuckets
+func parseBuckets(value string) ([]float64, error) {
+	var buckets []float64
+	for _, field := range strings.Split(value, ",") {
+		bucket, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid runtime bucket %q", field)
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, validateBuckets(buckets)
+}
+
+// Returns the keys of the attributes in sorted order
+func sortedKeys(attributes map[string]string) []string {
+	var keys []string
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Writes the config file to a temporary directory and loads it
+func writeConfig(t *testing.T, content string) (*config, string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "sqlc-metrics.yaml")
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadConfig(filename, dir)
+	return c, dir, err
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	enabled, disabled := true, false
+	const content = `
+defaults:
+  invocationMetrics: true
+  errorMetrics: true
+  runtimeMetrics: true
+packages:
+  .:
+    runtimeMetrics: false
+    queries:
+      GetUser:
+        runtimeMetrics: true
+        errorMetrics: false
+`
+	tests := []struct {
+		name        string
+		content     string
+		flags       settings
+		query       string
+		wantOptions [3]bool
+	}{
+		{"no config", "", settings{}, "ListUsers", [3]bool{false, false, false}},
+		{"defaults", "defaults:\n  errorMetrics: true\n", settings{}, "ListUsers", [3]bool{false, true, false}},
+		{"package overrides defaults", content, settings{}, "ListUsers", [3]bool{true, true, false}},
+		{"query overrides package", content, settings{}, "GetUser", [3]bool{true, false, true}},
+		{"flags override package", content, settings{RuntimeMetrics: &enabled}, "ListUsers", [3]bool{true, true, true}},
+		{"flags override query", content, settings{ErrorMetrics: &enabled, InvocationMetrics: &disabled}, "GetUser", [3]bool{false, true, true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var c *config
+			dir := t.TempDir()
+			if test.content != "" {
+				var err error
+				c, dir, err = writeConfig(t, test.content)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			q := newPackageOptions(c, dir, test.flags).query(test.query)
+			got := [3]bool{q.InvocationMetrics, q.ErrorMetrics, q.RuntimeMetrics}
+			if got != test.wantOptions {
+				t.Errorf("invocation, error and runtime metrics of %s = %v, want %v", test.query, got, test.wantOptions)
+			}
+		})
+	}
+}
+
+func TestConfigQueryOverrides(t *testing.T) {
+	c, dir, err := writeConfig(t, `
+defaults:
+  attributes:
+    service: users
+packages:
+  .:
+    runtimeBuckets: [0.1, 1]
+    attributes:
+      db: primary
+    queries:
+      GetUser:
+        name: user_lookup
+        description: Looks up a user
+        runtimeBuckets: [0.5, 5]
+        attributes:
+          db: replica
+      DeleteUser:
+        exclude: true
+  other:
+    errorMetrics: true
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := newPackageOptions(c, dir, settings{})
+	if options.settings.ErrorMetrics != nil {
+		t.Errorf("the settings of another package apply")
+	}
+
+	q := options.query("GetUser")
+	if q.Name != "user_lookup" || !q.NameOverride {
+		t.Errorf("Name = %q, NameOverride = %v, want the configured name", q.Name, q.NameOverride)
+	}
+	if q.Description != "Looks up a user" {
+		t.Errorf("Description = %q, want the configured description", q.Description)
+	}
+	if !slices.Equal(q.RuntimeBuckets, []float64{0.5, 5}) {
+		t.Errorf("RuntimeBuckets = %v, want the buckets of the query", q.RuntimeBuckets)
+	}
+	if q.Attributes["service"] != "users" || q.Attributes["db"] != "replica" {
+		t.Errorf("Attributes = %v, want the merged attributes with the one of the query taking precedence", q.Attributes)
+	}
+	if q.Excluded {
+		t.Errorf("GetUser is excluded")
+	}
+
+	q = options.query("ListUsers")
+	if q.Name != "list_users" || q.NameOverride {
+		t.Errorf("Name = %q, NameOverride = %v, want the name derived from the query", q.Name, q.NameOverride)
+	}
+	if !slices.Equal(q.RuntimeBuckets, []float64{0.1, 1}) {
+		t.Errorf("RuntimeBuckets = %v, want the buckets of the package", q.RuntimeBuckets)
+	}
+	if q.Attributes["db"] != "primary" {
+		t.Errorf("Attributes = %v, want the attribute of the package", q.Attributes)
+	}
+
+	if !options.query("DeleteUser").Excluded {
+		t.Errorf("DeleteUser is not excluded")
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantKind errorKind
+		wantErr  string
+	}{
+		{"unknown setting", "defaults:\n  errorMetric: true\n", parseError, "field errorMetric not found"},
+		{"unknown query setting", "packages:\n  .:\n    queries:\n      GetUser:\n        runtimeMetric: true\n", parseError, "field runtimeMetric not found"},
+		{"name in defaults", "defaults:\n  name: users\n", usageError, "name can not be set for defaults"},
+		{"description in package", "packages:\n  .:\n    description: users\n", usageError, "description can not be set for package ."},
+		{"traces for query", "packages:\n  .:\n    queries:\n      GetUser:\n        traces: true\n", usageError, "traces can not be set for query GetUser"},
+		{"txRetries for query", "packages:\n  .:\n    queries:\n      GetUser:\n        txRetries: 1\n", usageError, "txRetries can not be set for query GetUser"},
+		{"negative txRetries", "defaults:\n  txRetries: -1\n", usageError, "txRetries can not be negative"},
+		{"decreasing buckets", "packages:\n  .:\n    runtimeBuckets: [1, 0.5]\n", usageError, "strictly increasing"},
+		{"invalid name template", "defaults:\n  nameTemplate: \"{{.Query\"\n", usageError, "invalid name template"},
+		{"invalid separator", "defaults:\n  separator: \" \"\n", usageError, "can not be part of a metric name"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := writeConfig(t, test.content)
+			var generatorErr *generatorError
+			if !errors.As(err, &generatorErr) {
+				t.Fatalf("loadConfig() = %v, want a %v error", err, test.wantKind)
+			}
+			if generatorErr.Kind != test.wantKind || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("loadConfig() = %v (%v), want %q (%v)", err, generatorErr.Kind, test.wantErr, test.wantKind)
+			}
+		})
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	enabled := true
+	hash := func(content string, flags settings) string {
+		t.Helper()
+		c, dir, err := writeConfig(t, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newPackageOptions(c, dir, flags).configHash
+	}
+	base := hash("defaults:\n  errorMetrics: true\n", settings{})
+	if base == "" {
+		t.Fatal("configHash is empty")
+	}
+	if got := hash("# Comments and formatting do not matter\ndefaults: {errorMetrics: true}\n", settings{}); got != base {
+		t.Errorf("configHash of the reformatted config = %s, want %s", got, base)
+	}
+	if got := hash("defaults:\n  errorMetrics: true\n", settings{RuntimeMetrics: &enabled}); got != base {
+		t.Errorf("configHash with flags = %s, want %s, since the flags are described separately", got, base)
+	}
+	if got := hash("packages:\n  .:\n    errorMetrics: true\n", settings{}); got != base {
+		t.Errorf("configHash of the same setting on the package = %s, want %s", got, base)
+	}
+	if got := hash("defaults:\n  errorMetrics: false\n", settings{}); got == base {
+		t.Errorf("configHash of another value = %s, want it to differ", got)
+	}
+	if got := hash("defaults:\n  errorMetrics: true\npackages:\n  .:\n    queries:\n      GetUser:\n        name: user\n", settings{}); got == base {
+		t.Errorf("configHash with a query override = %s, want it to differ", got)
+	}
+	if got := newPackageOptions(nil, t.TempDir(), settings{}).configHash; got != "" {
+		t.Errorf("configHash without a config = %s, want none", got)
+	}
+}
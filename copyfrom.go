@@ -0,0 +1,271 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Returns the CopyFrom call of a :copyfrom query generated for pgx, or nil if the function is no such query
+func copyfromCall(FuncDecl *ast.FuncDecl) *ast.CallExpr {
+	if FuncDecl.Recv == nil || len(FuncDecl.Recv.List) != 1 || len(FuncDecl.Recv.List[0].Names) != 1 || FuncDecl.Recv.List[0].Names[0].Name != "q" || FuncDecl.Body == nil {
+		return nil
+	}
+	var call *ast.CallExpr
+	ast.Inspect(FuncDecl.Body, func(node ast.Node) bool {
+		if CallExpr, ok := node.(*ast.CallExpr); ok && len(CallExpr.Args) == 4 {
+			if SelectorExpr, ok := CallExpr.Fun.(*ast.SelectorExpr); ok && SelectorExpr.Sel.Name == "CopyFrom" {
+				call = CallExpr
+			}
+		}
+		return call == nil
+	})
+	return call
+}
+
+// Returns the sql of a :copyfrom query. sqlc generates none for pgx, so it is built from the table and the columns the
+// query copies into. It takes the place of the sql of the other queries for the version, the kind and the semantic
+// conventions.
+func copyfromSQL(fset *token.FileSet, name string, call *ast.CallExpr) (string, error) {
+	var identifiers [2][]string
+	for i := range identifiers {
+		CompositeLit, ok := call.Args[i+1].(*ast.CompositeLit)
+		if !ok {
+			return "", newError(unsupportedError, fset.Position(call.Pos()), name, "the table and the columns of CopyFrom have to be string slice literals")
+		}
+		for _, elt := range CompositeLit.Elts {
+			BasicLit, ok := elt.(*ast.BasicLit)
+			if !ok || BasicLit.Kind != token.STRING {
+				return "", newError(unsupportedError, fset.Position(elt.Pos()), name, "the table and the columns of CopyFrom have to be string slice literals")
+			}
+			value, _ := strconv.Unquote(BasicLit.Value)
+			identifiers[i] = append(identifiers[i], value)
+		}
+	}
+	return "-- name: " + name + " :copyfrom\nCOPY " + strings.Join(identifiers[0], ".") + " (" + strings.Join(identifiers[1], ", ") + ") FROM STDIN", nil
+}
+
+// Records the sql and the doc comment of every :copyfrom query in the file, like addQuerySources does for the query
+// files
+func addCopyfromSources(fset *token.FileSet, file *ast.File, options *packageOptions) error {
+	addQuerySources(file, options)
+	for _, decl := range file.Decls {
+		FuncDecl, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		call := copyfromCall(FuncDecl)
+		if call == nil {
+			continue
+		}
+		name := setExported(strings.TrimSuffix(FuncDecl.Name.Name, "Original"))
+		sql, err := copyfromSQL(fset, name, call)
+		if err != nil {
+			return err
+		}
+		source := options.sources[name]
+		source.SQL = sql
+		options.sources[name] = source
+	}
+	return nil
+}
+
+// Records the number of rows passed to a :copyfrom query, the length of its slice parameter
+func recordInputRows(name string, param *ast.Field, options queryOptions) ast.Stmt {
+	return &ast.ExprStmt{
+		X: &ast.CallExpr{
+			Fun: &ast.SelectorExpr{
+				X: &ast.SelectorExpr{
+					X: &ast.Ident{
+						Name: "q",
+					},
+					Sel: &ast.Ident{
+						Name: options.field(name, "InputRowsHistogram"),
+					},
+				},
+				Sel: &ast.Ident{
+					Name: "Record",
+				},
+			},
+			Args: append([]ast.Expr{
+				&ast.Ident{
+					Name: "ctx",
+				},
+				&ast.CallExpr{
+					Fun: &ast.Ident{
+						Name: "int64",
+					},
+					Args: []ast.Expr{
+						&ast.CallExpr{
+							Fun: &ast.Ident{
+								Name: "len",
+							},
+							Args: []ast.Expr{
+								&ast.Ident{
+									Name: param.Names[0].Name,
+								},
+							},
+						},
+					},
+				},
+			}, measurementOptions(metricAttributes(name, options), options)...),
+		},
+	}
+}
+
+// Instruments the :copyfrom queries of the file sqlc generates for pgx. They are renamed and wrapped like the methods of
+// the query files, the iterators sqlc generates for them are left alone. The MySQL variant, which has no CopyFrom call,
+// is not instrumented.
+func modifyCopyfromFile(fset *token.FileSet, file *ast.File, options *packageOptions) (*ast.File, []string, error) {
+
+	if len(file.Comments) == 0 {
+		return nil, nil, newError(unsupportedError, fset.Position(file.Package), "", "file has no sqlc header comment")
+	}
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && copyfromCall(FuncDecl) != nil {
+			if err := validateQueryFunction(fset, FuncDecl); err != nil {
+				return nil, nil, err
+			}
+			params := FuncDecl.Type.Params.List
+			if _, ok := params[len(params)-1].Type.(*ast.ArrayType); !ok || len(params[len(params)-1].Names) != 1 {
+				return nil, nil, newError(unsupportedError, fset.Position(FuncDecl.Pos()), FuncDecl.Name.Name, "copyfrom queries have to take the rows as their last parameter")
+			}
+		}
+	}
+	if previouslyModified(file) {
+		stripCopyfromFile(file)
+	}
+	addModifiedComment(file, options.describe())
+
+	var foundFunctions []string
+	addMissingImports(file, querySqlFileImports)
+	if err := addCopyfromSources(fset, file, options); err != nil {
+		return nil, nil, err
+	}
+
+	var versions []ast.Decl
+	for i, decl := range file.Decls {
+		FuncDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || copyfromCall(FuncDecl) == nil {
+			continue
+		}
+		name := FuncDecl.Name.Name
+		version, err := queryVersion(options.sources[name].SQL)
+		if err != nil {
+			return nil, nil, newError(unsupportedError, fset.Position(FuncDecl.Pos()), name, "version can not be computed: %w", err)
+		}
+		versions = append(versions, &ast.GenDecl{
+			Tok: token.CONST,
+			Specs: []ast.Spec{
+				&ast.ValueSpec{
+					Names: []*ast.Ident{
+						&ast.Ident{
+							Name: setUnexported(name) + "Version",
+						},
+					},
+					Values: []ast.Expr{
+						&ast.BasicLit{
+							Kind:  token.STRING,
+							Value: "\"" + version + "\"",
+						},
+					},
+				},
+			},
+		})
+		if options.query(name).Excluded {
+			continue
+		}
+		foundFunctions = append(foundFunctions, name)
+		renameAndWrap(file, &decl, i, options.query(name))
+	}
+	file.Decls = append(file.Decls, versions...)
+	//Only keep the imports the enabled metrics use
+	removeUnusedImports(file, querySqlFileImports)
+	return file, foundFunctions, nil
+}
+
+// Removes everything modifyCopyfromFile added, leaving the file as sqlc generated it
+func stripCopyfromFile(file *ast.File) {
+	//The version constants have no sql constant next to them, so they are found by their query
+	versions := map[string]bool{}
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && copyfromCall(FuncDecl) != nil {
+			versions[strings.TrimSuffix(FuncDecl.Name.Name, "Original")+"Version"] = true
+		}
+	}
+	var decls []ast.Decl
+	for _, decl := range file.Decls {
+		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.CONST && len(GenDecl.Specs) == 1 {
+			if ValueSpec, ok := GenDecl.Specs[0].(*ast.ValueSpec); ok && len(ValueSpec.Names) == 1 && versions[ValueSpec.Names[0].Name] {
+				continue
+			}
+		}
+		decls = append(decls, decl)
+	}
+	file.Decls = decls
+
+	//The wrappers and the imports are removed like the ones of a query file
+	stripQuerySqlFile(file)
+}
+
+// Checks that the copyfrom file is instrumented with the given options and returns the instrumented queries
+func checkCopyfromFile(fset *token.FileSet, file *ast.File, options *packageOptions) ([]error, []string, error) {
+	var problems []error
+	var foundFunctions []string
+
+	if !previouslyModified(file) {
+		problems = append(problems, newError(checkError, fset.Position(file.Package), "", "file is not instrumented"))
+	} else if recorded := modifiedOptions(file); !slices.Equal(recorded, options.describe()) {
+		problems = append(problems, newError(checkError, fset.Position(file.Package), "", "file is instrumented with options %q, expected %q", strings.Join(recorded, " "), strings.Join(options.describe(), " ")))
+	}
+	if err := addCopyfromSources(fset, file, options); err != nil {
+		return nil, nil, err
+	}
+
+	functions := map[string]bool{}
+	versions := map[string]*ast.ValueSpec{}
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && FuncDecl.Recv != nil {
+			functions[FuncDecl.Name.Name] = true
+		}
+		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.CONST {
+			for _, spec := range GenDecl.Specs {
+				if ValueSpec, ok := spec.(*ast.ValueSpec); ok && len(ValueSpec.Names) == 1 {
+					versions[ValueSpec.Names[0].Name] = ValueSpec
+				}
+			}
+		}
+	}
+	for _, decl := range file.Decls {
+		FuncDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || copyfromCall(FuncDecl) == nil {
+			continue
+		}
+		name := setExported(strings.TrimSuffix(FuncDecl.Name.Name, "Original"))
+		switch {
+		case FuncDecl.Name.Name != name && !functions[name]:
+			problems = append(problems, newError(checkError, fset.Position(FuncDecl.Pos()), name, "wrapper is missing"))
+		case FuncDecl.Name.Name != name:
+			foundFunctions = append(foundFunctions, name)
+		case !options.query(name).Excluded:
+			problems = append(problems, newError(checkError, fset.Position(FuncDecl.Pos()), name, "query is not instrumented"))
+		}
+
+		//Every query needs a version constant matching its current table and columns
+		version, err := queryVersion(options.sources[name].SQL)
+		if err != nil {
+			return nil, nil, newError(unsupportedError, fset.Position(FuncDecl.Pos()), name, "version can not be computed: %w", err)
+		}
+		versionSpec, ok := versions[setUnexported(name)+"Version"]
+		if !ok {
+			problems = append(problems, newError(checkError, fset.Position(FuncDecl.Pos()), name, "version constant is missing"))
+			continue
+		}
+		if recordedVersion(versionSpec) != "\""+version+"\"" {
+			problems = append(problems, newError(checkError, fset.Position(versionSpec.Pos()), name, "version constant does not match the query"))
+		}
+	}
+	return problems, foundFunctions, nil
+}
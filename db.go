@@ -3,40 +3,481 @@ package main
 import (
 	"go/ast"
 	"go/token"
+	"strconv"
 	"strings"
 )
 
-func modifyDbFile(file *ast.File, foundFunctions []string, generateInvocationMetrics, generateErrorMetrics, generateQueryRuntimeMetrics, generateConnectionRetriever bool) *ast.File {
+var dbFileImports = []string{
+	"context",
+	"go.opentelemetry.io/otel/metric",
+}
+
+// The import the type of the attribute extractor uses
+const attributeImport = "go.opentelemetry.io/otel/attribute"
+
+// The imports New uses to create the tracer
+var traceImports = []string{
+	"go.opentelemetry.io/otel",
+	"go.opentelemetry.io/otel/trace",
+}
+
+func modifyDbFile(fset *token.FileSet, file *ast.File, foundFunctions, batchQueries []string, options *packageOptions) (*ast.File, error) {
+
+	if len(file.Comments) == 0 {
+		return nil, newError(unsupportedError, fset.Position(file.Package), "", "file has no sqlc header comment")
+	}
+	var hasNew, hasQueries bool
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && FuncDecl.Recv == nil && FuncDecl.Name.Name == "New" {
+			hasNew = true
+		}
+		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.TYPE {
+			if TypeSpec, ok := GenDecl.Specs[0].(*ast.TypeSpec); ok && TypeSpec.Name.Name == "Queries" {
+				if _, ok := TypeSpec.Type.(*ast.StructType); !ok {
+					return nil, newError(unsupportedError, fset.Position(TypeSpec.Pos()), "", "Queries has to be a struct")
+				}
+				hasQueries = true
+			}
+		}
+	}
+	if !hasNew || !hasQueries {
+		return nil, newError(unsupportedError, fset.Position(file.Package), "", "file has no New function or Queries struct")
+	}
+	//With emit_methods_with_db_argument the connection is passed to every query instead of being stored in Queries
+	methodsWithDbArgument := options.sqlc.EmitMethodsWithDbArgument || !queriesHasField(file, "db")
+	//With emit_prepared_queries sqlc generates a Prepare function next to New
+	preparedQueries := findPrepare(file) != nil
+	if methodsWithDbArgument && preparedQueries {
+		return nil, newError(unsupportedError, fset.Position(file.Package), "", "emit_prepared_queries is not supported with emit_methods_with_db_argument")
+	}
+	if methodsWithDbArgument && options.connectionRetriever() {
+		return nil, newError(unsupportedError, fset.Position(file.Package), "", "the connection retriever is not supported with emit_methods_with_db_argument")
+	}
+	if methodsWithDbArgument && options.txHelper() {
+		return nil, newError(unsupportedError, fset.Position(file.Package), "", "RunInTx is not supported with emit_methods_with_db_argument")
+	}
+
+	if err := validateMetricNames(fset, file, foundFunctions, batchQueries, options); err != nil {
+		return nil, err
+	}
 
 	if previouslyModified(file) {
-		panic("modifyDbFile called more than once")
+		stripDbFile(file)
 	}
-	addModifiedComment(file)
+	addModifiedComment(file, options.describe())
 
-	requiredImports := []string{
-		"context",
-		"go.opentelemetry.io/otel/metric",
+	addMissingImports(file, dbFileImports)
+	if options.attributeExtractor() {
+		addMissingImports(file, []string{attributeImport})
+	}
+	if options.traces() {
+		addMissingImports(file, traceImports)
+	}
+	if options.txHelper() {
+		addMissingImports(file, txHelperImports)
+	}
+	if preparedQueries {
+		addMissingImports(file, prepareImports)
 	}
-	addMissingImports(file, requiredImports)
 
-	replaceNewFunction(file, generateInvocationMetrics, generateErrorMetrics, generateQueryRuntimeMetrics)
+	var runtimeFunctions, invocationFunctions, errorFunctions, rowFunctions, inFlightFunctions []string
+	for _, function := range foundFunctions {
+		queryOptions := options.query(function)
+		if queryOptions.RuntimeMetrics {
+			runtimeFunctions = append(runtimeFunctions, function)
+		}
+		if queryOptions.InvocationMetrics {
+			invocationFunctions = append(invocationFunctions, function)
+		}
+		if queryOptions.ErrorMetrics {
+			errorFunctions = append(errorFunctions, function)
+		}
+		if queryOptions.rowMetrics() {
+			rowFunctions = append(rowFunctions, function)
+		}
+		if queryOptions.InFlightMetrics {
+			inFlightFunctions = append(inFlightFunctions, function)
+		}
+	}
 
-	generateQueryStruct(file, foundFunctions, generateInvocationMetrics, generateErrorMetrics, generateQueryRuntimeMetrics)
-	if generateQueryRuntimeMetrics {
-		file.Decls = append(file.Decls, createInitRuntimeMetricsFunction(foundFunctions))
+	var initFunctions []*ast.FuncDecl
+	if len(runtimeFunctions) > 0 {
+		initFunctions = append(initFunctions, createInitRuntimeMetricsFunction(runtimeFunctions, options))
+	}
+	if len(invocationFunctions) > 0 {
+		initFunctions = append(initFunctions, createInitCallMetricsFunction(invocationFunctions, options))
+	}
+	if len(errorFunctions) > 0 {
+		initFunctions = append(initFunctions, createInitErrorMetricsFunction(errorFunctions, options))
+	}
+	if len(rowFunctions) > 0 {
+		initFunctions = append(initFunctions, createInitRowMetricsFunction(rowFunctions, options))
+	}
+	if len(inFlightFunctions) > 0 {
+		initFunctions = append(initFunctions, createInitInFlightMetricsFunction(inFlightFunctions, options))
 	}
-	if generateInvocationMetrics {
-		file.Decls = append(file.Decls, createInitCallMetricsFunction(foundFunctions))
+	if options.txHelper() {
+		initFunctions = append(initFunctions, createInitPackageMetricsFunction("initTxMetrics", txMetricName, txInstruments(options), options))
 	}
-	if generateErrorMetrics {
-		file.Decls = append(file.Decls, createInitErrorMetricsFunction(foundFunctions))
+	if preparedQueries {
+		initFunctions = append(initFunctions, createInitPackageMetricsFunction("initPrepareMetrics", prepareMetricName, prepareInstruments(), options))
+	}
+	if len(batchQueries) > 0 && len(batchInstruments(options)) > 0 {
+		initFunctions = append(initFunctions, createInitPackageMetricsFunction("initBatchMetrics", batchMetricName, batchInstruments(options), options))
+	}
+	var initFunctionNames []string
+	for _, initFunction := range initFunctions {
+		initFunctionNames = append(initFunctionNames, initFunction.Name.Name)
+	}
+	replaceNewFunction(file, initFunctionNames, options.basename(), options.attributeExtractor(), options.traces(), methodsWithDbArgument)
+	if preparedQueries {
+		if err := instrumentPrepare(fset, file, options); err != nil {
+			return nil, err
+		}
 	}
 
-	if generateConnectionRetriever {
+	generateQueryStruct(file, foundFunctions, options, preparedQueries, len(batchQueries) > 0)
+	rewriteWithTx(file)
+	for _, initFunction := range initFunctions {
+		file.Decls = append(file.Decls, initFunction)
+	}
+
+	if options.connectionRetriever() {
 		file.Decls = append(file.Decls, createConnectionRetrievalFunction())
 	}
+	if options.txHelper() {
+		decls, err := createTxHelperFunctions(fset, file, options)
+		if err != nil {
+			return nil, err
+		}
+		file.Decls = append(file.Decls, decls...)
+	}
+	if preparedQueries {
+		decl, err := createPrepareStatementFunction(fset, file, options)
+		if err != nil {
+			return nil, err
+		}
+		file.Decls = append(file.Decls, decl)
+	}
+	//prepareStatement and the batches record the error.type of failed statements and queued queries
+	if usesClassifyError(foundFunctions, options) || preparedQueries || (len(batchQueries) > 0 && newBatchOptions(options).ErrorMetrics) {
+		if strings.EqualFold(options.sqlc.Engine, "mysql") {
+			if err := checkMySQLDriver(fset, file, options.sqlc.Path); err != nil {
+				return nil, err
+			}
+		}
+		decl, err := createClassifyErrorFunction(fset, file, options)
+		if err != nil {
+			return nil, err
+		}
+		addMissingImports(file, classifyErrorImports)
+		file.Decls = append(file.Decls, decl)
+		removeUnusedImports(file, classifyErrorImports)
+	}
+
+	return file, nil
+}
+
+// Removes everything modifyDbFile added, leaving the file as sqlc generated it
+func stripDbFile(file *ast.File) {
+	removeModifiedComment(file)
+
+	removeFunctions(file, func(FuncDecl *ast.FuncDecl) bool {
+		if FuncDecl.Recv == nil {
+			return FuncDecl.Name.Name == classifyErrorFunction
+		}
+		switch FuncDecl.Name.Name {
+		case "initRuntimeMetrics", "initCallMetrics", "initErrorMetrics", "initRowMetrics", "initInFlightMetrics", "initTxMetrics", "initPrepareMetrics", "initBatchMetrics", "RunInTx", "runInTx", prepareStatementFunction, "GetConnection":
+			return true
+		}
+		return false
+	})
+	restoreNewFunction(file, !queriesHasField(file, "db"))
+	restoreQueryStruct(file)
+	restoreWithTx(file)
+	restorePrepare(file)
+
+	removeUnusedImports(file, dbFileImports)
+	removeUnusedImports(file, []string{attributeImport})
+	removeUnusedImports(file, traceImports)
+	removeUnusedImports(file, txHelperImports)
+	removeUnusedImports(file, prepareImports)
+	removeUnusedImports(file, classifyErrorImports)
+}
+
+// Returns true if the Queries struct has a field with the given name
+func queriesHasField(file *ast.File, name string) bool {
+	for _, decl := range file.Decls {
+		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.TYPE {
+			if TypeSpec, ok := GenDecl.Specs[0].(*ast.TypeSpec); ok && TypeSpec.Name.Name == "Queries" {
+				for _, field := range TypeSpec.Type.(*ast.StructType).Fields.List {
+					for _, fieldName := range field.Names {
+						if fieldName.Name == name {
+							return true
+						}
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Restores the New function generated by sqlc
+func restoreNewFunction(file *ast.File, methodsWithDbArgument bool) {
+	for i, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && FuncDecl.Recv == nil && FuncDecl.Name.Name == "New" {
+			file.Decls[i] = &ast.FuncDecl{
+				Name: &ast.Ident{
+					Name: "New",
+				},
+				Type: &ast.FuncType{
+					Params: &ast.FieldList{
+						List: []*ast.Field{
+							{
+								Names: []*ast.Ident{
+									{
+										Name: "db",
+									},
+								},
+								Type: &ast.Ident{
+									Name: "DBTX",
+								},
+							},
+						},
+					},
+					Results: &ast.FieldList{
+						List: []*ast.Field{
+							{
+								Type: &ast.StarExpr{
+									X: &ast.Ident{
+										Name: "Queries",
+									},
+								},
+							},
+						},
+					},
+				},
+				Body: &ast.BlockStmt{
+					List: []ast.Stmt{
+						&ast.ReturnStmt{
+							Results: []ast.Expr{
+								&ast.UnaryExpr{
+									Op: token.AND,
+									X: &ast.CompositeLit{
+										Type: &ast.Ident{
+											Name: "Queries",
+										},
+										Elts: []ast.Expr{
+											&ast.KeyValueExpr{
+												Key: &ast.Ident{
+													Name: "db",
+												},
+												Value: &ast.Ident{
+													Name: "db",
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+			if methodsWithDbArgument {
+				removeDbArgument(file.Decls[i].(*ast.FuncDecl))
+			}
+		}
+	}
+}
+
+// Removes the db parameter and the db field of the Queries literal from New, with emit_methods_with_db_argument the
+// connection is passed to every query instead
+func removeDbArgument(New *ast.FuncDecl) {
+	New.Type.Params.List = New.Type.Params.List[1:]
+	ast.Inspect(New.Body, func(node ast.Node) bool {
+		if CompositeLit, ok := node.(*ast.CompositeLit); ok {
+			var elts []ast.Expr
+			for _, elt := range CompositeLit.Elts {
+				if KeyValueExpr, ok := elt.(*ast.KeyValueExpr); ok && KeyValueExpr.Key.(*ast.Ident).Name == "db" {
+					continue
+				}
+				elts = append(elts, elt)
+			}
+			CompositeLit.Elts = elts
+		}
+		return true
+	})
+}
+
+// Removes the fields added by generateQueryStruct from the Queries struct
+func restoreQueryStruct(file *ast.File) {
+	for _, decl := range file.Decls {
+		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.TYPE {
+			if TypeSpec, ok := GenDecl.Specs[0].(*ast.TypeSpec); ok && TypeSpec.Name.Name == "Queries" {
+				StructType := TypeSpec.Type.(*ast.StructType)
+				var list []*ast.Field
+				for _, field := range StructType.Fields.List {
+					if len(field.Names) == 1 && generatedQueryStructField(field.Names[0].Name) {
+						continue
+					}
+					list = append(list, field)
+				}
+				StructType.Fields.List = list
+			}
+		}
+	}
+}
+
+// Replaces the body of WithTx with a copy of q that has the fields of the sqlc literal set, so queries within a
+// transaction record on the instruments created by New instead of nil ones
+func rewriteWithTx(file *ast.File) {
+	for _, decl := range file.Decls {
+		FuncDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || FuncDecl.Recv == nil || FuncDecl.Name.Name != "WithTx" || len(FuncDecl.Body.List) != 1 {
+			continue
+		}
+		ReturnStmt, ok := FuncDecl.Body.List[0].(*ast.ReturnStmt)
+		if !ok || len(ReturnStmt.Results) != 1 {
+			continue
+		}
+		UnaryExpr, ok := ReturnStmt.Results[0].(*ast.UnaryExpr)
+		if !ok {
+			continue
+		}
+		CompositeLit, ok := UnaryExpr.X.(*ast.CompositeLit)
+		if !ok || len(CompositeLit.Elts) == 0 {
+			continue
+		}
+		//The statements take the lines of the literal, so the layout of the function stays the same
+		List := []ast.Stmt{
+			&ast.AssignStmt{
+				Lhs: []ast.Expr{
+					&ast.Ident{
+						NamePos: ReturnStmt.Pos(),
+						Name:    "queries",
+					},
+				},
+				TokPos: ReturnStmt.Pos(),
+				Tok:    token.DEFINE,
+				Rhs: []ast.Expr{
+					&ast.StarExpr{
+						Star: ReturnStmt.Pos(),
+						X: &ast.Ident{
+							NamePos: ReturnStmt.Pos(),
+							Name:    "q",
+						},
+					},
+				},
+			},
+		}
+		for _, elt := range CompositeLit.Elts {
+			KeyValueExpr, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				List = nil
+				break
+			}
+			List = append(List, &ast.AssignStmt{
+				Lhs: []ast.Expr{
+					&ast.SelectorExpr{
+						X: &ast.Ident{
+							NamePos: KeyValueExpr.Pos(),
+							Name:    "queries",
+						},
+						Sel: &ast.Ident{
+							NamePos: KeyValueExpr.Pos(),
+							Name:    KeyValueExpr.Key.(*ast.Ident).Name,
+						},
+					},
+				},
+				TokPos: KeyValueExpr.Colon,
+				Tok:    token.ASSIGN,
+				Rhs:    []ast.Expr{KeyValueExpr.Value},
+			})
+		}
+		if List == nil {
+			continue
+		}
+		FuncDecl.Body.List = append(List, &ast.ReturnStmt{
+			Return: CompositeLit.Rbrace,
+			Results: []ast.Expr{
+				&ast.UnaryExpr{
+					OpPos: CompositeLit.Rbrace,
+					Op:    token.AND,
+					X: &ast.Ident{
+						NamePos: CompositeLit.Rbrace,
+						Name:    "queries",
+					},
+				},
+			},
+		})
+	}
+}
+
+// Restores the WithTx method generated by sqlc, which returns a new Queries with only the fields it sets
+func restoreWithTx(file *ast.File) {
+	for _, decl := range file.Decls {
+		FuncDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || FuncDecl.Recv == nil || FuncDecl.Name.Name != "WithTx" || len(FuncDecl.Body.List) < 3 {
+			continue
+		}
+		if AssignStmt, ok := FuncDecl.Body.List[0].(*ast.AssignStmt); !ok || !isIdent(AssignStmt.Lhs[0], "queries") {
+			continue
+		}
+		//sqlc puts every field on a line of its own, the literal takes the lines of the statements to keep that layout
+		first, last := FuncDecl.Body.List[0], FuncDecl.Body.List[len(FuncDecl.Body.List)-1]
+		var elts []ast.Expr
+		for _, stmt := range FuncDecl.Body.List[1 : len(FuncDecl.Body.List)-1] {
+			AssignStmt := stmt.(*ast.AssignStmt)
+			elts = append(elts, &ast.KeyValueExpr{
+				Key: &ast.Ident{
+					NamePos: AssignStmt.Pos(),
+					Name:    AssignStmt.Lhs[0].(*ast.SelectorExpr).Sel.Name,
+				},
+				Colon: AssignStmt.TokPos,
+				Value: AssignStmt.Rhs[0],
+			})
+		}
+		FuncDecl.Body.List = []ast.Stmt{
+			&ast.ReturnStmt{
+				Return: first.Pos(),
+				Results: []ast.Expr{
+					&ast.UnaryExpr{
+						OpPos: first.Pos(),
+						Op:    token.AND,
+						X: &ast.CompositeLit{
+							Type: &ast.Ident{
+								NamePos: first.Pos(),
+								Name:    "Queries",
+							},
+							Lbrace: first.Pos(),
+							Elts:   elts,
+							Rbrace: last.Pos(),
+						},
+					},
+				},
+			},
+		}
+	}
+}
 
-	return file
+func generatedQueryStructField(name string) bool {
+	switch {
+	case name == "meter", name == "basename", name == "attributeExtractor", name == "tracer", name == txQueriesField:
+		return true
+	case name == "txDurationHistogram", name == "txQueriesHistogram", name == "txCommitCounter", name == "txRollbackCounter", name == "txErrorCounter", name == "txRetryCounter":
+		return true
+	case name == "prepareDurationHistogram", name == "prepareErrorCounter":
+		return true
+	case name == "batchSizeHistogram", name == "batchDurationHistogram", name == "batchSuccessCounter", name == "batchErrorCounter":
+		return true
+	case name == "runtimeHistogram", name == "runtimeGauge", name == "invocationCounter", name == "errorCounter", name == "rowsHistogram", name == "inFlightCounter":
+		return true
+	case strings.HasSuffix(name, "RowsHistogram"), strings.HasSuffix(name, "InFlightCounter"), strings.HasSuffix(name, "RuntimeHistogram"), strings.HasSuffix(name, "RuntimeGauge"), strings.HasSuffix(name, "InvocationCounter"), strings.HasSuffix(name, "ErrorCounter"):
+		return true
+	}
+	return false
 }
 
 func createConnectionRetrievalFunction() *ast.FuncDecl {
@@ -91,9 +532,37 @@ func createConnectionRetrievalFunction() *ast.FuncDecl {
 	}
 }
 
-// Replaces the New function, with one that requires a metric meter and a basename
-func replaceNewFunction(file *ast.File, generateInvocationMetrics, generateErrorMetrics, generateQueryRuntimeMetrics bool) {
+// Replaces the New function, with one that requires a metric meter and a basename and calls the given init functions
+func replaceNewFunction(file *ast.File, initFunctions []string, basename string, attributeExtractor, traces bool, methodsWithDbArgument bool) {
 
+	elts := []ast.Expr{
+		&ast.KeyValueExpr{
+			Key: &ast.Ident{
+				Name: "db",
+			},
+			Value: &ast.Ident{
+				Name: "db",
+			},
+		},
+		&ast.KeyValueExpr{
+			Key: &ast.Ident{
+				Name: "meter",
+			},
+			Value: &ast.Ident{
+				Name: "meter",
+			},
+		},
+		&ast.KeyValueExpr{
+			Key: &ast.Ident{
+				Name: "basename",
+			},
+			Value: &ast.StarExpr{
+				X: &ast.Ident{
+					Name: "basename",
+				},
+			},
+		},
+	}
 	List := []ast.Stmt{
 		&ast.IfStmt{
 			Cond: &ast.BinaryExpr{
@@ -117,7 +586,7 @@ func replaceNewFunction(file *ast.File, generateInvocationMetrics, generateError
 						Rhs: []ast.Expr{
 							&ast.BasicLit{
 								Kind:  token.STRING,
-								Value: "\"sqlc\"",
+								Value: strconv.Quote(basename),
 							},
 						},
 					},
@@ -140,44 +609,86 @@ func replaceNewFunction(file *ast.File, generateInvocationMetrics, generateError
 				},
 			},
 		},
-		&ast.AssignStmt{
-			Lhs: []ast.Expr{
-				&ast.Ident{
-					Name: "q",
+	}
+	//Without an extractor no attributes are added from the context
+	if attributeExtractor {
+		List = append(List, &ast.IfStmt{
+			Cond: &ast.BinaryExpr{
+				X: &ast.Ident{
+					Name: "attributeExtractor",
+				},
+				Op: token.EQL,
+				Y: &ast.Ident{
+					Name: "nil",
 				},
 			},
-			Tok: token.DEFINE,
-			Rhs: []ast.Expr{
-				&ast.UnaryExpr{
-					Op: token.AND,
-					X: &ast.CompositeLit{
-						Type: &ast.Ident{
-							Name: "Queries",
+			Body: &ast.BlockStmt{
+				List: []ast.Stmt{
+					&ast.AssignStmt{
+						Lhs: []ast.Expr{
+							&ast.Ident{
+								Name: "attributeExtractor",
+							},
 						},
-						Elts: []ast.Expr{
-							&ast.KeyValueExpr{
-								Key: &ast.Ident{
-									Name: "db",
-								},
-								Value: &ast.Ident{
-									Name: "db",
+						Tok: token.ASSIGN,
+						Rhs: []ast.Expr{
+							&ast.FuncLit{
+								Type: attributeExtractorType(false),
+								Body: &ast.BlockStmt{
+									List: []ast.Stmt{
+										&ast.ReturnStmt{
+											Results: []ast.Expr{
+												&ast.Ident{
+													Name: "nil",
+												},
+											},
+										},
+									},
 								},
 							},
-							&ast.KeyValueExpr{
-								Key: &ast.Ident{
-									Name: "meter",
-								},
-								Value: &ast.Ident{
-									Name: "meter",
-								},
+						},
+					},
+				},
+			},
+		})
+		elts = append(elts, &ast.KeyValueExpr{
+			Key: &ast.Ident{
+				Name: "attributeExtractor",
+			},
+			Value: &ast.Ident{
+				Name: "attributeExtractor",
+			},
+		})
+	}
+	//Without a tracer provider the global one is used
+	if traces {
+		List = append(List, &ast.IfStmt{
+			Cond: &ast.BinaryExpr{
+				X: &ast.Ident{
+					Name: "tracerProvider",
+				},
+				Op: token.EQL,
+				Y: &ast.Ident{
+					Name: "nil",
+				},
+			},
+			Body: &ast.BlockStmt{
+				List: []ast.Stmt{
+					&ast.AssignStmt{
+						Lhs: []ast.Expr{
+							&ast.Ident{
+								Name: "tracerProvider",
 							},
-							&ast.KeyValueExpr{
-								Key: &ast.Ident{
-									Name: "basename",
-								},
-								Value: &ast.StarExpr{
+						},
+						Tok: token.ASSIGN,
+						Rhs: []ast.Expr{
+							&ast.CallExpr{
+								Fun: &ast.SelectorExpr{
 									X: &ast.Ident{
-										Name: "basename",
+										Name: "otel",
+									},
+									Sel: &ast.Ident{
+										Name: "GetTracerProvider",
 									},
 								},
 							},
@@ -185,17 +696,60 @@ func replaceNewFunction(file *ast.File, generateInvocationMetrics, generateError
 					},
 				},
 			},
-		},
+		})
+		elts = append(elts, &ast.KeyValueExpr{
+			Key: &ast.Ident{
+				Name: "tracer",
+			},
+			Value: &ast.CallExpr{
+				Fun: &ast.SelectorExpr{
+					X: &ast.Ident{
+						Name: "tracerProvider",
+					},
+					Sel: &ast.Ident{
+						Name: "Tracer",
+					},
+				},
+				Args: []ast.Expr{
+					&ast.StarExpr{
+						X: &ast.Ident{
+							Name: "basename",
+						},
+					},
+				},
+			},
+		})
 	}
+	List = append(List, &ast.AssignStmt{
+		Lhs: []ast.Expr{
+			&ast.Ident{
+				Name: "q",
+			},
+		},
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{
+			&ast.UnaryExpr{
+				Op: token.AND,
+				X: &ast.CompositeLit{
+					Type: &ast.Ident{
+						Name: "Queries",
+					},
+					Elts: elts,
+				},
+			},
+		},
+	})
 
-	if generateQueryRuntimeMetrics {
+	//The first init call declares err
+	errTok := token.DEFINE
+	for _, initFunction := range initFunctions {
 		List = append(List, &ast.AssignStmt{
 			Lhs: []ast.Expr{
 				&ast.Ident{
 					Name: "err",
 				},
 			},
-			Tok: token.DEFINE,
+			Tok: errTok,
 			Rhs: []ast.Expr{
 				&ast.CallExpr{
 					Fun: &ast.SelectorExpr{
@@ -203,7 +757,7 @@ func replaceNewFunction(file *ast.File, generateInvocationMetrics, generateError
 							Name: "q",
 						},
 						Sel: &ast.Ident{
-							Name: "initRuntimeMetrics",
+							Name: initFunction,
 						},
 					},
 				},
@@ -234,107 +788,12 @@ func replaceNewFunction(file *ast.File, generateInvocationMetrics, generateError
 				},
 			},
 		})
+		errTok = token.ASSIGN
 	}
-
-	if generateInvocationMetrics {
-		List = append(List, &ast.AssignStmt{
-			Lhs: []ast.Expr{
-				&ast.Ident{
-					Name: "err",
-				},
-			},
-			Tok: token.ASSIGN,
-			Rhs: []ast.Expr{
-				&ast.CallExpr{
-					Fun: &ast.SelectorExpr{
-						X: &ast.Ident{
-							Name: "q",
-						},
-						Sel: &ast.Ident{
-							Name: "initCallMetrics",
-						},
-					},
-				},
-			},
-		})
-		List = append(List, &ast.IfStmt{
-			Cond: &ast.BinaryExpr{
-				X: &ast.Ident{
-					Name: "err",
-				},
-				Op: token.NEQ,
-				Y: &ast.Ident{
-					Name: "nil",
-				},
-			},
-			Body: &ast.BlockStmt{
-				List: []ast.Stmt{
-					&ast.ReturnStmt{
-						Results: []ast.Expr{
-							&ast.Ident{
-								Name: "nil",
-							},
-							&ast.Ident{
-								Name: "err",
-							},
-						},
-					},
-				},
-			},
-		})
-	}
-
-	if generateErrorMetrics {
-		List = append(List, &ast.AssignStmt{
-			Lhs: []ast.Expr{
-				&ast.Ident{
-					Name: "err",
-				},
-			},
-			Tok: token.ASSIGN,
-			Rhs: []ast.Expr{
-				&ast.CallExpr{
-					Fun: &ast.SelectorExpr{
-						X: &ast.Ident{
-							Name: "q",
-						},
-						Sel: &ast.Ident{
-							Name: "initErrorMetrics",
-						},
-					},
-				},
-			},
-		})
-		List = append(List, &ast.IfStmt{
-			Cond: &ast.BinaryExpr{
-				X: &ast.Ident{
-					Name: "err",
-				},
-				Op: token.NEQ,
-				Y: &ast.Ident{
-					Name: "nil",
-				},
-			},
-			Body: &ast.BlockStmt{
-				List: []ast.Stmt{
-					&ast.ReturnStmt{
-						Results: []ast.Expr{
-							&ast.Ident{
-								Name: "nil",
-							},
-							&ast.Ident{
-								Name: "err",
-							},
-						},
-					},
-				},
-			},
-		})
-	}
-	List = append(List, &ast.ReturnStmt{
-		Results: []ast.Expr{
-			&ast.Ident{
-				Name: "q",
+	List = append(List, &ast.ReturnStmt{
+		Results: []ast.Expr{
+			&ast.Ident{
+				Name: "q",
 			},
 			&ast.Ident{
 				Name: "nil",
@@ -413,24 +872,106 @@ func replaceNewFunction(file *ast.File, generateInvocationMetrics, generateError
 						List: List,
 					},
 				}
+				if attributeExtractor {
+					Params := file.Decls[i].(*ast.FuncDecl).Type.Params
+					Params.List = append(Params.List, &ast.Field{
+						Names: []*ast.Ident{
+							{
+								Name: "attributeExtractor",
+							},
+						},
+						Type: attributeExtractorType(true),
+					})
+				}
+				if traces {
+					Params := file.Decls[i].(*ast.FuncDecl).Type.Params
+					Params.List = append(Params.List, &ast.Field{
+						Names: []*ast.Ident{
+							{
+								Name: "tracerProvider",
+							},
+						},
+						Type: &ast.SelectorExpr{
+							X: &ast.Ident{
+								Name: "trace",
+							},
+							Sel: &ast.Ident{
+								Name: "TracerProvider",
+							},
+						},
+					})
+				}
+				if methodsWithDbArgument {
+					removeDbArgument(file.Decls[i].(*ast.FuncDecl))
+				}
 			}
 		}
 	}
 }
 
-// Add a metric value to the Query struct for each function
-func generateQueryStruct(file *ast.File, foundFunctions []string, generateInvocationMetrics, generateErrorMetrics, generateQueryRuntimeMetrics bool) {
-	list := []*ast.Field{
+// Returns the type of the function returning the attributes from the context of a query, with named parameters for
+// the signature of New and the Queries struct
+func attributeExtractorType(named bool) *ast.FuncType {
+	params := []*ast.Field{
 		{
-			Names: []*ast.Ident{
-				{
-					Name: "db",
+			Type: &ast.SelectorExpr{
+				X: &ast.Ident{
+					Name: "context",
+				},
+				Sel: &ast.Ident{
+					Name: "Context",
 				},
 			},
+		},
+		{
 			Type: &ast.Ident{
-				Name: "DBTX",
+				Name: "string",
+			},
+		},
+	}
+	if named {
+		params[0].Names = []*ast.Ident{{Name: "ctx"}}
+		params[1].Names = []*ast.Ident{{Name: "query"}}
+	}
+	return &ast.FuncType{
+		Params: &ast.FieldList{
+			List: params,
+		},
+		Results: &ast.FieldList{
+			List: []*ast.Field{
+				{
+					Type: &ast.ArrayType{
+						Elt: &ast.SelectorExpr{
+							X: &ast.Ident{
+								Name: "attribute",
+							},
+							Sel: &ast.Ident{
+								Name: "KeyValue",
+							},
+						},
+					},
+				},
 			},
 		},
+	}
+}
+
+// Add a metric value to the Query struct for each function. The fields sqlc generated, like the connection or the
+// prepared statements, are kept in front.
+func generateQueryStruct(file *ast.File, foundFunctions []string, options *packageOptions, preparedQueries, batchQueries bool) {
+	var list []*ast.Field
+	for _, decl := range file.Decls {
+		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.TYPE {
+			if TypeSpec, ok := GenDecl.Specs[0].(*ast.TypeSpec); ok && TypeSpec.Name.Name == "Queries" {
+				for _, field := range TypeSpec.Type.(*ast.StructType).Fields.List {
+					//The struct is created anew, positions of the old one would mess up its formatting
+					clearPositions(field)
+					list = append(list, field)
+				}
+			}
+		}
+	}
+	list = append(list, []*ast.Field{
 		{
 			Names: []*ast.Ident{
 				{
@@ -456,62 +997,118 @@ func generateQueryStruct(file *ast.File, foundFunctions []string, generateInvoca
 				Name: "string",
 			},
 		},
+	}...)
+	if options.attributeExtractor() {
+		list = append(list, &ast.Field{
+			Names: []*ast.Ident{
+				{
+					Name: "attributeExtractor",
+				},
+			},
+			Type: attributeExtractorType(true),
+		})
 	}
-	if generateQueryRuntimeMetrics {
-		for _, function := range foundFunctions {
-			list = append(list, &ast.Field{
-				Names: []*ast.Ident{
-					{
-						Name: setUnexported(function) + "RuntimeGauge",
-					},
+	if options.traces() {
+		list = append(list, &ast.Field{
+			Names: []*ast.Ident{
+				{
+					Name: "tracer",
 				},
-				Type: &ast.SelectorExpr{
-					X: &ast.Ident{
-						Name: "metric",
-					},
-					Sel: &ast.Ident{
-						Name: "Float64Gauge",
-					},
+			},
+			Type: &ast.SelectorExpr{
+				X: &ast.Ident{
+					Name: "trace",
 				},
-			})
-		}
+				Sel: &ast.Ident{
+					Name: "Tracer",
+				},
+			},
+		})
 	}
-	if generateInvocationMetrics {
-		for _, function := range foundFunctions {
-			list = append(list, &ast.Field{
-				Names: []*ast.Ident{
-					{
-						Name: setUnexported(function) + "InvocationCounter",
-					},
+	//Shared instruments are only added once
+	added := map[string]bool{}
+	addField := func(field, instrument string) {
+		if added[field] {
+			return
+		}
+		added[field] = true
+		list = append(list, &ast.Field{
+			Names: []*ast.Ident{
+				{
+					Name: field,
 				},
-				Type: &ast.SelectorExpr{
-					X: &ast.Ident{
-						Name: "metric",
-					},
-					Sel: &ast.Ident{
-						Name: "Int64Counter",
-					},
+			},
+			Type: &ast.SelectorExpr{
+				X: &ast.Ident{
+					Name: "metric",
 				},
-			})
+				Sel: &ast.Ident{
+					Name: instrument,
+				},
+			},
+		})
+	}
+	for _, function := range foundFunctions {
+		if queryOptions := options.query(function); queryOptions.RuntimeMetrics {
+			addField(queryOptions.field(function, "RuntimeHistogram"), "Float64Histogram")
+			if queryOptions.RuntimeGauge {
+				addField(queryOptions.field(function, "RuntimeGauge"), "Float64Gauge")
+			}
 		}
 	}
-	if generateErrorMetrics {
-		for _, function := range foundFunctions {
-			list = append(list, &ast.Field{
-				Names: []*ast.Ident{
-					{
-						Name: setUnexported(function) + "ErrorCounter",
-					},
+	for _, function := range foundFunctions {
+		if queryOptions := options.query(function); queryOptions.InvocationMetrics {
+			addField(queryOptions.field(function, "InvocationCounter"), "Int64Counter")
+		}
+	}
+	for _, function := range foundFunctions {
+		if queryOptions := options.query(function); queryOptions.ErrorMetrics {
+			addField(queryOptions.field(function, "ErrorCounter"), "Int64Counter")
+		}
+	}
+	for _, function := range foundFunctions {
+		if queryOptions := options.query(function); queryOptions.rowMetrics() {
+			addField(queryOptions.field(function, "RowsHistogram"), "Int64Histogram")
+		}
+		if queryOptions := options.query(function); queryOptions.inputRowMetrics() {
+			addField(queryOptions.field(function, "InputRowsHistogram"), "Int64Histogram")
+		}
+	}
+	for _, function := range foundFunctions {
+		if queryOptions := options.query(function); queryOptions.InFlightMetrics {
+			addField(queryOptions.field(function, "InFlightCounter"), "Int64UpDownCounter")
+		}
+	}
+	if options.txHelper() {
+		for _, instrument := range txInstruments(options) {
+			addField(instrument.field, instrument.instrument)
+		}
+		list = append(list, &ast.Field{
+			Names: []*ast.Ident{
+				{
+					Name: txQueriesField,
 				},
-				Type: &ast.SelectorExpr{
+			},
+			Type: &ast.StarExpr{
+				X: &ast.SelectorExpr{
 					X: &ast.Ident{
-						Name: "metric",
+						Name: "atomic",
 					},
 					Sel: &ast.Ident{
-						Name: "Int64Counter",
+						Name: "Int64",
 					},
 				},
-			})
+			},
+		})
+	}
+	if preparedQueries {
+		for _, instrument := range prepareInstruments() {
+			addField(instrument.field, instrument.instrument)
+		}
+	}
+	if batchQueries {
+		for _, instrument := range batchInstruments(options) {
+			addField(instrument.field, instrument.instrument)
 		}
 	}
 	for i, decl := range file.Decls {
@@ -532,14 +1129,312 @@ func generateQueryStruct(file *ast.File, foundFunctions []string, generateInvoca
 							},
 						},
 					},
-				}
-			}
+				}
+			}
+		}
+	}
+}
+
+// Returns the options setting the unit and the description of an instrument
+func unitAndDescription(unit, description string) []ast.Expr {
+	return []ast.Expr{
+		&ast.CallExpr{
+			Fun: &ast.SelectorExpr{
+				X: &ast.Ident{
+					Name: "metric",
+				},
+				Sel: &ast.Ident{
+					Name: "WithUnit",
+				},
+			},
+			Args: []ast.Expr{
+				&ast.BasicLit{
+					Kind:  token.STRING,
+					Value: strconv.Quote(unit),
+				},
+			},
+		},
+		&ast.CallExpr{
+			Fun: &ast.SelectorExpr{
+				X: &ast.Ident{
+					Name: "metric",
+				},
+				Sel: &ast.Ident{
+					Name: "WithDescription",
+				},
+			},
+			Args: []ast.Expr{
+				&ast.BasicLit{
+					Kind:  token.STRING,
+					Value: strconv.Quote(description),
+				},
+			},
+		},
+	}
+}
+
+// Creates the instrument stored in the given Queries field and returns the error, if any
+func initMetric(field, instrument string, name ast.Expr, instrumentOptions ...ast.Expr) []ast.Stmt {
+	return []ast.Stmt{
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{
+				&ast.SelectorExpr{
+					X: &ast.Ident{
+						Name: "q",
+					},
+					Sel: &ast.Ident{
+						Name: field,
+					},
+				},
+				&ast.Ident{
+					Name: "err",
+				},
+			},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{
+				&ast.CallExpr{
+					Fun: &ast.SelectorExpr{
+						X: &ast.SelectorExpr{
+							X: &ast.Ident{
+								Name: "q",
+							},
+							Sel: &ast.Ident{
+								Name: "meter",
+							},
+						},
+						Sel: &ast.Ident{
+							Name: instrument,
+						},
+					},
+					Args: append([]ast.Expr{name}, instrumentOptions...),
+				},
+			},
+		},
+		&ast.IfStmt{
+			Cond: &ast.BinaryExpr{
+				X: &ast.Ident{
+					Name: "err",
+				},
+				Op: token.NEQ,
+				Y: &ast.Ident{
+					Name: "nil",
+				},
+			},
+			Body: &ast.BlockStmt{
+				List: []ast.Stmt{
+					&ast.ReturnStmt{
+						Results: []ast.Expr{
+							&ast.Ident{
+								Name: "err",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func createInitRuntimeMetricsFunction(fundFunctions []string, options *packageOptions) *ast.FuncDecl {
+	//Create empty initMetric function
+	initMetricsFunction := &ast.FuncDecl{
+		Recv: &ast.FieldList{
+			List: []*ast.Field{
+				{
+					Names: []*ast.Ident{
+						{
+							Name: "q",
+						},
+					},
+					Type: &ast.StarExpr{
+						X: &ast.Ident{
+							Name: "Queries",
+						},
+					},
+				},
+			},
+		},
+		Name: &ast.Ident{
+			Name: "initRuntimeMetrics",
+		},
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{},
+			Results: &ast.FieldList{
+				List: []*ast.Field{
+					{
+						Type: &ast.Ident{
+							Name: "error",
+						},
+					},
+				},
+			},
+		},
+
+		Body: &ast.BlockStmt{
+			List: []ast.Stmt{},
+		},
+	}
+
+	//Add error var
+	initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, &ast.DeclStmt{
+		Decl: &ast.GenDecl{
+			Tok: token.VAR,
+			Specs: []ast.Spec{
+				&ast.ValueSpec{
+					Names: []*ast.Ident{
+						{
+							Name: "err",
+						},
+					},
+					Type: &ast.Ident{
+						Name: "error",
+					},
+				},
+			},
+		},
+	})
+
+	//Init metric for each found function, shared instruments are only created once
+	initialized := map[string]bool{}
+	for _, functionName := range fundFunctions {
+		queryOptions := options.query(functionName)
+		var buckets []ast.Expr
+		for _, bucket := range queryOptions.RuntimeBuckets {
+			buckets = append(buckets, &ast.BasicLit{
+				Kind:  token.FLOAT,
+				Value: strconv.FormatFloat(bucket, 'g', -1, 64),
+			})
+		}
+		if field := queryOptions.field(functionName, "RuntimeHistogram"); !initialized[field] {
+			initialized[field] = true
+			instrumentOptions := []ast.Expr{
+				&ast.CallExpr{
+					Fun: &ast.SelectorExpr{
+						X: &ast.Ident{
+							Name: "metric",
+						},
+						Sel: &ast.Ident{
+							Name: "WithExplicitBucketBoundaries",
+						},
+					},
+					Args: buckets,
+				},
+			}
+			//The names are checked by validateMetricNames
+			metricName, _ := queryOptions.metricName(functionName, "runtime", "histogram")
+			name := metricNameExpr(metricName)
+			//The semantic conventions define the name, unit and description of the histogram, without a basename
+			if queryOptions.Semconv {
+				name = &ast.BasicLit{
+					Kind:  token.STRING,
+					Value: strconv.Quote(semconvDurationMetric),
+				}
+				instrumentOptions = append(instrumentOptions, unitAndDescription("s", "Duration of database client operations.")...)
+			} else {
+				instrumentOptions = append(instrumentOptions, unitAndDescription("s", queryOptions.description("Runtime of the queries"))...)
+			}
+			initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, initMetric(field, "Float64Histogram", name, instrumentOptions...)...)
+		}
+		if field := queryOptions.field(functionName, "RuntimeGauge"); queryOptions.RuntimeGauge && !initialized[field] {
+			initialized[field] = true
+			metricName, _ := queryOptions.metricName(functionName, "runtime", "gauge")
+			initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, initMetric(field, "Float64Gauge", metricNameExpr(metricName), unitAndDescription("s", queryOptions.description("Runtime of the queries"))...)...)
+		}
+	}
+	initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, &ast.ReturnStmt{
+		Results: []ast.Expr{
+			&ast.Ident{
+				Name: "nil",
+			},
+		},
+	})
+
+	return initMetricsFunction
+}
+
+func createInitErrorMetricsFunction(fundFunctions []string, options *packageOptions) *ast.FuncDecl {
+	//Create empty InitErrorMetrics function
+	initMetricsFunction := &ast.FuncDecl{
+		Recv: &ast.FieldList{
+			List: []*ast.Field{
+				{
+					Names: []*ast.Ident{
+						{
+							Name: "q",
+						},
+					},
+					Type: &ast.StarExpr{
+						X: &ast.Ident{
+							Name: "Queries",
+						},
+					},
+				},
+			},
+		},
+		Name: &ast.Ident{
+			Name: "initErrorMetrics",
+		},
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{},
+			Results: &ast.FieldList{
+				List: []*ast.Field{
+					{
+						Type: &ast.Ident{
+							Name: "error",
+						},
+					},
+				},
+			},
+		},
+
+		Body: &ast.BlockStmt{
+			List: []ast.Stmt{},
+		},
+	}
+
+	//Add error var
+	initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, &ast.DeclStmt{
+		Decl: &ast.GenDecl{
+			Tok: token.VAR,
+			Specs: []ast.Spec{
+				&ast.ValueSpec{
+					Names: []*ast.Ident{
+						{
+							Name: "err",
+						},
+					},
+					Type: &ast.Ident{
+						Name: "error",
+					},
+				},
+			},
+		},
+	})
+
+	//Init metric for each found function, shared instruments are only created once
+	initialized := map[string]bool{}
+	for _, functionName := range fundFunctions {
+		queryOptions := options.query(functionName)
+		if field := queryOptions.field(functionName, "ErrorCounter"); !initialized[field] {
+			initialized[field] = true
+			//The names are checked by validateMetricNames
+			metricName, _ := queryOptions.metricName(functionName, "error", "counter")
+			initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, initMetric(field, "Int64Counter", metricNameExpr(metricName), unitAndDescription("{error}", queryOptions.description("Failed calls of the queries"))...)...)
 		}
 	}
+	initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, &ast.ReturnStmt{
+		Results: []ast.Expr{
+			&ast.Ident{
+				Name: "nil",
+			},
+		},
+	})
+
+	return initMetricsFunction
 }
 
-func createInitRuntimeMetricsFunction(fundFunctions []string) *ast.FuncDecl {
-	//Create empty initMetric function
+func createInitCallMetricsFunction(fundFunctions []string, options *packageOptions) *ast.FuncDecl {
+	//Create empty InitErrorMetrics function
 	initMetricsFunction := &ast.FuncDecl{
 		Recv: &ast.FieldList{
 			List: []*ast.Field{
@@ -558,7 +1453,7 @@ func createInitRuntimeMetricsFunction(fundFunctions []string) *ast.FuncDecl {
 			},
 		},
 		Name: &ast.Ident{
-			Name: "initRuntimeMetrics",
+			Name: "initCallMetrics",
 		},
 		Type: &ast.FuncType{
 			Params: &ast.FieldList{},
@@ -597,84 +1492,16 @@ func createInitRuntimeMetricsFunction(fundFunctions []string) *ast.FuncDecl {
 		},
 	})
 
-	//Init metric for each found function
+	//Init metric for each found function, shared instruments are only created once
+	initialized := map[string]bool{}
 	for _, functionName := range fundFunctions {
-		//Init metric
-		initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, &ast.AssignStmt{
-			Lhs: []ast.Expr{
-				&ast.SelectorExpr{
-					X: &ast.Ident{
-						Name: "q",
-					},
-					Sel: &ast.Ident{
-						Name: setUnexported(functionName) + "RuntimeGauge",
-					},
-				},
-				&ast.Ident{
-					Name: "err",
-				},
-			},
-			Tok: token.ASSIGN,
-			Rhs: []ast.Expr{
-				&ast.CallExpr{
-					Fun: &ast.SelectorExpr{
-						X: &ast.SelectorExpr{
-							X: &ast.Ident{
-								Name: "q",
-							},
-							Sel: &ast.Ident{
-								Name: "meter",
-							},
-						},
-						Sel: &ast.Ident{
-							Name: "Float64Gauge",
-						},
-					},
-					Args: []ast.Expr{
-						&ast.ParenExpr{
-							X: &ast.BinaryExpr{
-								X: &ast.SelectorExpr{
-									X: &ast.Ident{
-										Name: "q",
-									},
-									Sel: &ast.Ident{
-										Name: "basename",
-									},
-								},
-								Op: token.ADD,
-								Y: &ast.BasicLit{
-									Kind:  token.STRING,
-									Value: "\"" + strings.ToLower(toSnakeCase(functionName)) + "_runtime_gauge\"",
-								},
-							},
-						},
-					},
-				},
-			},
-		})
-		//If error handler
-		initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, &ast.IfStmt{
-			Cond: &ast.BinaryExpr{
-				X: &ast.Ident{
-					Name: "err",
-				},
-				Op: token.NEQ,
-				Y: &ast.Ident{
-					Name: "nil",
-				},
-			},
-			Body: &ast.BlockStmt{
-				List: []ast.Stmt{
-					&ast.ReturnStmt{
-						Results: []ast.Expr{
-							&ast.Ident{
-								Name: "err",
-							},
-						},
-					},
-				},
-			},
-		})
+		queryOptions := options.query(functionName)
+		if field := queryOptions.field(functionName, "InvocationCounter"); !initialized[field] {
+			initialized[field] = true
+			//The names are checked by validateMetricNames
+			metricName, _ := queryOptions.metricName(functionName, "call", "counter")
+			initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, initMetric(field, "Int64Counter", metricNameExpr(metricName), unitAndDescription("{call}", queryOptions.description("Calls of the queries"))...)...)
+		}
 	}
 	initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, &ast.ReturnStmt{
 		Results: []ast.Expr{
@@ -687,8 +1514,11 @@ func createInitRuntimeMetricsFunction(fundFunctions []string) *ast.FuncDecl {
 	return initMetricsFunction
 }
 
-func createInitErrorMetricsFunction(fundFunctions []string) *ast.FuncDecl {
-	//Create empty InitErrorMetrics function
+// The bucket boundaries of the rows histogram, from single rows up to large result sets
+var rowsBuckets = []int{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000}
+
+func createInitRowMetricsFunction(fundFunctions []string, options *packageOptions) *ast.FuncDecl {
+	//Create empty initRowMetrics function
 	initMetricsFunction := &ast.FuncDecl{
 		Recv: &ast.FieldList{
 			List: []*ast.Field{
@@ -707,7 +1537,7 @@ func createInitErrorMetricsFunction(fundFunctions []string) *ast.FuncDecl {
 			},
 		},
 		Name: &ast.Ident{
-			Name: "initErrorMetrics",
+			Name: "initRowMetrics",
 		},
 		Type: &ast.FuncType{
 			Params: &ast.FieldList{},
@@ -746,84 +1576,56 @@ func createInitErrorMetricsFunction(fundFunctions []string) *ast.FuncDecl {
 		},
 	})
 
-	//Init metric for each found function
+	var buckets []ast.Expr
+	for _, bucket := range rowsBuckets {
+		buckets = append(buckets, &ast.BasicLit{
+			Kind:  token.INT,
+			Value: strconv.Itoa(bucket),
+		})
+	}
+	//Init metric for each found function, shared instruments are only created once
+	initialized := map[string]bool{}
 	for _, functionName := range fundFunctions {
-		//Init metric
-		initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, &ast.AssignStmt{
-			Lhs: []ast.Expr{
-				&ast.SelectorExpr{
-					X: &ast.Ident{
-						Name: "q",
-					},
-					Sel: &ast.Ident{
-						Name: setUnexported(functionName) + "ErrorCounter",
-					},
-				},
-				&ast.Ident{
-					Name: "err",
-				},
-			},
-			Tok: token.ASSIGN,
-			Rhs: []ast.Expr{
+		queryOptions := options.query(functionName)
+		if field := queryOptions.field(functionName, "RowsHistogram"); !initialized[field] {
+			initialized[field] = true
+			instrumentOptions := []ast.Expr{
 				&ast.CallExpr{
 					Fun: &ast.SelectorExpr{
-						X: &ast.SelectorExpr{
-							X: &ast.Ident{
-								Name: "q",
-							},
-							Sel: &ast.Ident{
-								Name: "meter",
-							},
+						X: &ast.Ident{
+							Name: "metric",
 						},
 						Sel: &ast.Ident{
-							Name: "Int64Counter",
+							Name: "WithExplicitBucketBoundaries",
 						},
 					},
-					Args: []ast.Expr{
-						&ast.ParenExpr{
-							X: &ast.BinaryExpr{
-								X: &ast.SelectorExpr{
-									X: &ast.Ident{
-										Name: "q",
-									},
-									Sel: &ast.Ident{
-										Name: "basename",
-									},
-								},
-								Op: token.ADD,
-								Y: &ast.BasicLit{
-									Kind:  token.STRING,
-									Value: "\"" + strings.ToLower(toSnakeCase(functionName)) + "_error_counter\"",
-								},
-							},
-						},
-					},
-				},
-			},
-		})
-		//If error handler
-		initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, &ast.IfStmt{
-			Cond: &ast.BinaryExpr{
-				X: &ast.Ident{
-					Name: "err",
-				},
-				Op: token.NEQ,
-				Y: &ast.Ident{
-					Name: "nil",
+					Args: buckets,
 				},
-			},
-			Body: &ast.BlockStmt{
-				List: []ast.Stmt{
-					&ast.ReturnStmt{
-						Results: []ast.Expr{
-							&ast.Ident{
-								Name: "err",
-							},
+			}
+			//The names are checked by validateMetricNames
+			metricName, _ := queryOptions.metricName(functionName, "rows", "histogram")
+			instrumentOptions = append(instrumentOptions, unitAndDescription("{row}", queryOptions.description("Rows returned or affected by the queries"))...)
+			initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, initMetric(field, "Int64Histogram", metricNameExpr(metricName), instrumentOptions...)...)
+		}
+		//:copyfrom queries also record the rows they were passed, next to the rows they copied
+		if field := queryOptions.field(functionName, "InputRowsHistogram"); queryOptions.inputRowMetrics() && !initialized[field] {
+			initialized[field] = true
+			metricName, _ := queryOptions.metricName(functionName, "input_rows", "histogram")
+			instrumentOptions := append([]ast.Expr{
+				&ast.CallExpr{
+					Fun: &ast.SelectorExpr{
+						X: &ast.Ident{
+							Name: "metric",
+						},
+						Sel: &ast.Ident{
+							Name: "WithExplicitBucketBoundaries",
 						},
 					},
+					Args: buckets,
 				},
-			},
-		})
+			}, unitAndDescription("{row}", queryOptions.description("Rows passed to the copyfrom queries"))...)
+			initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, initMetric(field, "Int64Histogram", metricNameExpr(metricName), instrumentOptions...)...)
+		}
 	}
 	initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, &ast.ReturnStmt{
 		Results: []ast.Expr{
@@ -836,8 +1638,8 @@ func createInitErrorMetricsFunction(fundFunctions []string) *ast.FuncDecl {
 	return initMetricsFunction
 }
 
-func createInitCallMetricsFunction(fundFunctions []string) *ast.FuncDecl {
-	//Create empty InitErrorMetrics function
+func createInitInFlightMetricsFunction(fundFunctions []string, options *packageOptions) *ast.FuncDecl {
+	//Create empty initInFlightMetrics function
 	initMetricsFunction := &ast.FuncDecl{
 		Recv: &ast.FieldList{
 			List: []*ast.Field{
@@ -856,7 +1658,7 @@ func createInitCallMetricsFunction(fundFunctions []string) *ast.FuncDecl {
 			},
 		},
 		Name: &ast.Ident{
-			Name: "initCallMetrics",
+			Name: "initInFlightMetrics",
 		},
 		Type: &ast.FuncType{
 			Params: &ast.FieldList{},
@@ -895,84 +1697,156 @@ func createInitCallMetricsFunction(fundFunctions []string) *ast.FuncDecl {
 		},
 	})
 
-	//Init metric for each found function
+	//Init metric for each found function, shared instruments are only created once
+	initialized := map[string]bool{}
 	for _, functionName := range fundFunctions {
-		//Init metric
-		initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, &ast.AssignStmt{
-			Lhs: []ast.Expr{
-				&ast.SelectorExpr{
-					X: &ast.Ident{
-						Name: "q",
+		queryOptions := options.query(functionName)
+		if field := queryOptions.field(functionName, "InFlightCounter"); !initialized[field] {
+			initialized[field] = true
+			//The names are checked by validateMetricNames
+			metricName, _ := queryOptions.metricName(functionName, "in_flight", "counter")
+			initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, initMetric(field, "Int64UpDownCounter", metricNameExpr(metricName), unitAndDescription("{call}", queryOptions.description("Calls of the queries in flight"))...)...)
+		}
+	}
+	initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, &ast.ReturnStmt{
+		Results: []ast.Expr{
+			&ast.Ident{
+				Name: "nil",
+			},
+		},
+	})
+
+	return initMetricsFunction
+}
+
+// An instrument of the whole package instead of a single query, like the ones of the transactions run by RunInTx
+type packageInstrument struct {
+	field       string
+	instrument  string
+	kind        []string
+	unit        string
+	description string
+}
+
+// Returns the name of a package metric, the name takes the place of the query in the naming template
+func (p *packageOptions) packageMetricName(name string, kind ...string) (string, error) {
+	options := p.query("")
+	options.SharedInstruments = false
+	options.NameOverride = true
+	options.Name = name
+	return options.metricName("", kind...)
+}
+
+// Returns the attributes recorded with every package metric, as source for the functions parsed from templates
+func packageAttributes(options *packageOptions) []string {
+	var attributes []string
+	if options.settings.Semconv != nil && *options.settings.Semconv {
+		attributes = append(attributes, "attribute.String(\"db.system.name\", "+strconv.Quote(options.query("").DbSystem)+")")
+	}
+	for _, key := range sortedKeys(options.settings.Attributes) {
+		attributes = append(attributes, "attribute.String("+strconv.Quote(key)+", "+strconv.Quote(options.settings.Attributes[key])+")")
+	}
+	return attributes
+}
+
+// Creates the init function with the given name, which creates the given package instruments. Float histograms record
+// durations and get the runtime buckets, int histograms record counts and get the rows buckets.
+func createInitPackageMetricsFunction(functionName, metricName string, instruments []packageInstrument, options *packageOptions) *ast.FuncDecl {
+	initMetricsFunction := &ast.FuncDecl{
+		Recv: &ast.FieldList{
+			List: []*ast.Field{
+				{
+					Names: []*ast.Ident{
+						{
+							Name: "q",
+						},
 					},
-					Sel: &ast.Ident{
-						Name: setUnexported(functionName) + "InvocationCounter",
+					Type: &ast.StarExpr{
+						X: &ast.Ident{
+							Name: "Queries",
+						},
 					},
 				},
-				&ast.Ident{
-					Name: "err",
-				},
 			},
-			Tok: token.ASSIGN,
-			Rhs: []ast.Expr{
-				&ast.CallExpr{
-					Fun: &ast.SelectorExpr{
-						X: &ast.SelectorExpr{
-							X: &ast.Ident{
-								Name: "q",
-							},
-							Sel: &ast.Ident{
-								Name: "meter",
-							},
-						},
-						Sel: &ast.Ident{
-							Name: "Int64Counter",
+		},
+		Name: &ast.Ident{
+			Name: functionName,
+		},
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{},
+			Results: &ast.FieldList{
+				List: []*ast.Field{
+					{
+						Type: &ast.Ident{
+							Name: "error",
 						},
 					},
-					Args: []ast.Expr{
-						&ast.ParenExpr{
-							X: &ast.BinaryExpr{
-								X: &ast.SelectorExpr{
-									X: &ast.Ident{
-										Name: "q",
-									},
-									Sel: &ast.Ident{
-										Name: "basename",
+				},
+			},
+		},
+		Body: &ast.BlockStmt{
+			List: []ast.Stmt{
+				&ast.DeclStmt{
+					Decl: &ast.GenDecl{
+						Tok: token.VAR,
+						Specs: []ast.Spec{
+							&ast.ValueSpec{
+								Names: []*ast.Ident{
+									{
+										Name: "err",
 									},
 								},
-								Op: token.ADD,
-								Y: &ast.BasicLit{
-									Kind:  token.STRING,
-									Value: "\"" + strings.ToLower(toSnakeCase(functionName)) + "_call_counter\"",
+								Type: &ast.Ident{
+									Name: "error",
 								},
 							},
 						},
 					},
 				},
 			},
-		})
-		//If error handler
-		initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, &ast.IfStmt{
-			Cond: &ast.BinaryExpr{
-				X: &ast.Ident{
-					Name: "err",
-				},
-				Op: token.NEQ,
-				Y: &ast.Ident{
-					Name: "nil",
-				},
-			},
-			Body: &ast.BlockStmt{
-				List: []ast.Stmt{
-					&ast.ReturnStmt{
-						Results: []ast.Expr{
-							&ast.Ident{
-								Name: "err",
-							},
-						},
+		},
+	}
+
+	runtimeBuckets := defaultRuntimeBuckets
+	if options.settings.RuntimeBuckets != nil {
+		runtimeBuckets = options.settings.RuntimeBuckets
+	}
+	for _, instrument := range instruments {
+		var buckets []ast.Expr
+		switch instrument.instrument {
+		case "Float64Histogram":
+			for _, bucket := range runtimeBuckets {
+				buckets = append(buckets, &ast.BasicLit{
+					Kind:  token.FLOAT,
+					Value: strconv.FormatFloat(bucket, 'g', -1, 64),
+				})
+			}
+		case "Int64Histogram":
+			for _, bucket := range rowsBuckets {
+				buckets = append(buckets, &ast.BasicLit{
+					Kind:  token.INT,
+					Value: strconv.Itoa(bucket),
+				})
+			}
+		}
+		var instrumentOptions []ast.Expr
+		if buckets != nil {
+			instrumentOptions = append(instrumentOptions, &ast.CallExpr{
+				Fun: &ast.SelectorExpr{
+					X: &ast.Ident{
+						Name: "metric",
+					},
+					Sel: &ast.Ident{
+						Name: "WithExplicitBucketBoundaries",
 					},
 				},
-			},
-		})
+				Args: buckets,
+			})
+		}
+		instrumentOptions = append(instrumentOptions, unitAndDescription(instrument.unit, instrument.description)...)
+		//The names are checked by validateMetricNames
+		name, _ := options.packageMetricName(metricName, instrument.kind...)
+		initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, initMetric(instrument.field, instrument.instrument, metricNameExpr(name), instrumentOptions...)...)
 	}
 	initMetricsFunction.Body.List = append(initMetricsFunction.Body.List, &ast.ReturnStmt{
 		Results: []ast.Expr{
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Number of unchanged lines shown around each change
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// Returns a unified diff between the old and new content of the named file, or an empty string if both are equal
+func unifiedDiff(filename string, old, new []byte) string {
+	if string(old) == string(new) {
+		return ""
+	}
+	ops := diffLines(splitLines(string(old)), splitLines(string(new)))
+
+	out := &strings.Builder{}
+	fmt.Fprintf(out, "--- %s\n+++ %s\n", filename, filename)
+	for start := 0; start < len(ops); {
+		//Find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		//Extend the hunk until there are more than two context blocks of unchanged lines
+		end := start
+		for end < len(ops) {
+			unchanged := 0
+			for end+unchanged < len(ops) && ops[end+unchanged].kind == ' ' {
+				unchanged++
+			}
+			if end+unchanged == len(ops) || unchanged > 2*diffContext {
+				break
+			}
+			end += unchanged + 1
+		}
+		first := max(start-diffContext, 0)
+		last := min(end+diffContext, len(ops))
+
+		oldLine, newLine := 1, 1
+		for _, op := range ops[:first] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[first:last] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+		for _, op := range ops[first:last] {
+			fmt.Fprintf(out, "%c%s", op.kind, op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				fmt.Fprint(out, "\n\\ No newline at end of file\n")
+			}
+		}
+		start = last
+	}
+	return out.String()
+}
+
+func hunkRange(line, count int) string {
+	if count == 0 {
+		line--
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// Splits s into lines that keep their line break, so a last line without one differs from the same line with one
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Computes the shortest edit script between a and b using the Myers algorithm. Step d only reads the diagonals -d to
+// d, so only those are kept for the backtracking, which needs O(d²) instead of O(d·(n+m)) memory.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(a, b, trace, d)
+			}
+		}
+	}
+	return nil
+}
+
+// Walks the trace of diffLines back from the end, the snapshot of step d holds the diagonal k at index k+d
+func backtrackDiff(a, b []string, trace [][]int, d int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+d]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, diffOp{'-', a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, diffOp{' ', a[x]})
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []diffOp
+	}{
+		{"both empty", nil, nil, nil},
+		{"insert into empty", nil, []string{"a\n"}, []diffOp{{'+', "a\n"}}},
+		{"delete everything", []string{"a\n"}, nil, []diffOp{{'-', "a\n"}}},
+		{"equal", []string{"a\n", "b\n"}, []string{"a\n", "b\n"}, []diffOp{{' ', "a\n"}, {' ', "b\n"}}},
+		{
+			"delete and append",
+			[]string{"a\n", "b\n", "c\n"},
+			[]string{"a\n", "c\n", "d\n"},
+			[]diffOp{{' ', "a\n"}, {'-', "b\n"}, {' ', "c\n"}, {'+', "d\n"}},
+		},
+		{
+			"replace",
+			[]string{"a\n", "b\n", "c\n"},
+			[]string{"a\n", "x\n", "c\n"},
+			[]diffOp{{' ', "a\n"}, {'-', "b\n"}, {'+', "x\n"}, {' ', "c\n"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := diffLines(test.a, test.b); !slices.Equal(got, test.want) {
+				t.Errorf("diffLines() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// Returns the lines from 1 to n, with the given lines replaced
+func numberedLines(n int, replacements map[int]string) string {
+	var lines strings.Builder
+	for i := 1; i <= n; i++ {
+		if replacement, ok := replacements[i]; ok {
+			lines.WriteString(replacement + "\n")
+		} else {
+			fmt.Fprintf(&lines, "%d\n", i)
+		}
+	}
+	return lines.String()
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{"equal", "a\n", "a\n", ""},
+		{"empty to non-empty", "", "a\nb\n", "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"non-empty to empty", "a\nb\n", "", "@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{
+			"missing trailing newline",
+			"a\nb\n",
+			"a\nb",
+			"@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n",
+		},
+		{
+			"added trailing newline",
+			"a",
+			"a\n",
+			"@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+a\n",
+		},
+		{
+			//Six unchanged lines between the changes are covered by the context of both
+			"changes merged into one hunk",
+			numberedLines(20, nil),
+			numberedLines(20, map[int]string{4: "x", 11: "y"}),
+			"@@ -1,14 +1,14 @@\n 1\n 2\n 3\n-4\n+x\n 5\n 6\n 7\n 8\n 9\n 10\n-11\n+y\n 12\n 13\n 14\n",
+		},
+		{
+			//Seven unchanged lines leave one line between the contexts
+			"changes in separate hunks",
+			numberedLines(20, nil),
+			numberedLines(20, map[int]string{4: "x", 12: "y"}),
+			"@@ -1,7 +1,7 @@\n 1\n 2\n 3\n-4\n+x\n 5\n 6\n 7\n@@ -9,7 +9,7 @@\n 9\n 10\n 11\n-12\n+y\n 13\n 14\n 15\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := test.want
+			if want != "" {
+				want = "--- db.go\n+++ db.go\n" + want
+			}
+			if got := unifiedDiff("db.go", []byte(test.old), []byte(test.new)); got != want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"io"
+)
+
+type errorKind int
+
+const (
+	checkError errorKind = iota + 1
+	usageError
+	parseError
+	unsupportedError
+	ioError
+)
+
+// Returns the exit code the generator terminates with if an error of this kind occurs
+func (k errorKind) exitCode() int {
+	switch k {
+	case checkError:
+		return 1
+	case usageError:
+		return 2
+	case parseError:
+		return 3
+	case unsupportedError:
+		return 4
+	case ioError:
+		return 5
+	}
+	return 1
+}
+
+func (k errorKind) String() string {
+	switch k {
+	case checkError:
+		return "check"
+	case usageError:
+		return "usage"
+	case parseError:
+		return "parse"
+	case unsupportedError:
+		return "unsupported"
+	case ioError:
+		return "io"
+	}
+	return "unknown"
+}
+
+func (k errorKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// An error of the generator, with the position and the query it relates to if known
+type generatorError struct {
+	Kind     errorKind
+	Position token.Position
+	Query    string
+	Err      error
+}
+
+func (e *generatorError) Error() string {
+	message := e.Err.Error()
+	if e.Query != "" {
+		message = e.Query + ": " + message
+	}
+	if e.Position.IsValid() || e.Position.Filename != "" {
+		message = e.Position.String() + ": " + message
+	}
+	return message
+}
+
+func (e *generatorError) Unwrap() error {
+	return e.Err
+}
+
+func newError(kind errorKind, position token.Position, query string, format string, args ...any) *generatorError {
+	return &generatorError{
+		Kind:     kind,
+		Position: position,
+		Query:    query,
+		Err:      fmt.Errorf(format, args...),
+	}
+}
+
+// Converts an error returned by the parser into parse errors carrying the position
+func parseErrors(filename string, err error) []error {
+	var list scanner.ErrorList
+	if errors.As(err, &list) {
+		var errs []error
+		for _, e := range list {
+			errs = append(errs, &generatorError{Kind: parseError, Position: e.Pos, Err: errors.New(e.Msg)})
+		}
+		return errs
+	}
+	return []error{&generatorError{Kind: parseError, Position: token.Position{Filename: filename}, Err: err}}
+}
+
+// Converts a read or write error into an io error for the given file
+func fileError(filename string, err error) error {
+	return &generatorError{Kind: ioError, Position: token.Position{Filename: filename}, Err: err}
+}
+
+type diagnostic struct {
+	Kind    errorKind `json:"kind"`
+	File    string    `json:"file,omitempty"`
+	Line    int       `json:"line,omitempty"`
+	Column  int       `json:"column,omitempty"`
+	Query   string    `json:"query,omitempty"`
+	Message string    `json:"message"`
+}
+
+// Writes the errors in the given format, either text or json, and returns the exit code of the first one
+func reportErrors(w io.Writer, format string, errs []error) int {
+	diagnostics := []diagnostic{}
+	for _, err := range errs {
+		d := diagnostic{Kind: unsupportedError, Message: err.Error()}
+		var generatorErr *generatorError
+		if errors.As(err, &generatorErr) {
+			d = diagnostic{
+				Kind:    generatorErr.Kind,
+				File:    generatorErr.Position.Filename,
+				Line:    generatorErr.Position.Line,
+				Column:  generatorErr.Position.Column,
+				Query:   generatorErr.Query,
+				Message: generatorErr.Err.Error(),
+			}
+		}
+		diagnostics = append(diagnostics, d)
+		if format != "json" {
+			fmt.Fprintln(w, err)
+		}
+	}
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(struct {
+			Diagnostics []diagnostic `json:"diagnostics"`
+		}{diagnostics})
+	}
+	if len(diagnostics) == 0 {
+		return 0
+	}
+	return diagnostics[0].Kind.exitCode()
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// The name of the generated function returning the error.type of a query error
+const classifyErrorFunction = "classifyQueryError"
+
+// The error.type of errors that only mean a query returned no rows
+const noRowsErrorType = "no_rows"
+
+// The driver classifyQueryError reads the error numbers of MySQL from
+const mysqlDriver = "github.com/go-sql-driver/mysql"
+
+// The imports classifyQueryError may use, the ones of the sql package are already imported by sqlc
+var classifyErrorImports = []string{
+	"context",
+	"database/sql/driver",
+	"errors",
+	mysqlDriver,
+	"io",
+	"net",
+	"strings",
+}
+
+// The function classifying query errors. SQLSTATE codes are read through the SQLState method both pgconn.PgError and
+// pq.Error provide, error numbers of MySQL from mysql.MySQLError.
+var classifyErrorTemplate = template.Must(template.New(classifyErrorFunction).Parse(`package db
+
+// Returns the class of a query error, which is recorded as the error.type attribute
+func classifyQueryError(err error) string {
+	if errors.Is(err, {{.NoRows}}) {
+		return "no_rows"
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "deadline_exceeded"
+	}
+	var sqlState interface{ SQLState() string }
+	if errors.As(err, &sqlState) {
+		code := sqlState.SQLState()
+		switch {
+		case code == "40001":
+			return "serialization_failure"
+		case code == "40P01":
+			return "deadlock"
+		case code == "55P03":
+			return "lock_timeout"
+		case code == "57014":
+			return "canceled"
+		case strings.HasPrefix(code, "23"):
+			return "constraint_violation"
+		case strings.HasPrefix(code, "08"), strings.HasPrefix(code, "57P"):
+			return "connection_error"
+		}
+	}
+{{- if .MySQL}}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1022, 1048, 1062, 1169, 1216, 1217, 1451, 1452, 1557, 1586, 3819:
+			return "constraint_violation"
+		case 1213:
+			return "deadlock"
+		case 1205:
+			return "lock_timeout"
+		case 1317, 3024:
+			return "canceled"
+		}
+	}
+	if errors.Is(err, mysql.ErrInvalidConn) {
+		return "connection_error"
+	}
+{{- end}}
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+		return "connection_error"
+	}
+	return "other"
+}
+`))
+
+// Creates classifyQueryError for the sql package the db file uses
+func createClassifyErrorFunction(fset *token.FileSet, file *ast.File, options *packageOptions) (ast.Decl, error) {
+	noRows := "sql.ErrNoRows"
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if path == "github.com/jackc/pgx/v5" || path == "github.com/jackc/pgx/v4" {
+			noRows = "pgx.ErrNoRows"
+		}
+	}
+	decls, err := parseTemplateDecls(classifyErrorTemplate, struct {
+		NoRows string
+		MySQL  bool
+	}{noRows, strings.EqualFold(options.sqlc.Engine, "mysql")})
+	if err != nil {
+		return nil, newError(unsupportedError, fset.Position(file.Package), "", "%w", err)
+	}
+	return decls[0], nil
+}
+
+// Returns an error if the module of the package in path does not require the MySQL driver, which classifyQueryError
+// imports for the mysql engine. Packages that are not within a module are not checked.
+func checkMySQLDriver(fset *token.FileSet, file *ast.File, path string) error {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	for {
+		content, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			for _, line := range strings.Split(string(content), "\n") {
+				//Matches both a single require directive and a line of a require block
+				fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(line), "require"))
+				if len(fields) > 0 && fields[0] == mysqlDriver {
+					return nil
+				}
+			}
+			return newError(usageError, fset.Position(file.Package), "", "the errors of the mysql engine are classified with %s, which %s does not require, add it with go get %s", mysqlDriver, filepath.Join(dir, "go.mod"), mysqlDriver)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// Executes the template and returns the declarations of the Go source it generates. The generated functions are
+// mostly fixed, so they are parsed from source instead of being built as an AST.
+func parseTemplateDecls(t *template.Template, data any) ([]ast.Decl, error) {
+	var source bytes.Buffer
+	if err := t.Execute(&source, data); err != nil {
+		return nil, fmt.Errorf("%s can not be generated: %w", t.Name(), err)
+	}
+	generated, err := parser.ParseFile(token.NewFileSet(), "", source.Bytes(), 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s can not be generated: %w", t.Name(), err)
+	}
+	for _, decl := range generated.Decls {
+		//Positions of another file set would mess up the formatting of the file the declarations are added to
+		clearPositions(decl)
+	}
+	return generated.Decls, nil
+}
+
+// Sets every position within node to token.NoPos
+func clearPositions(node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		if node == nil {
+			return false
+		}
+		value := reflect.ValueOf(node)
+		if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+			return true
+		}
+		value = value.Elem()
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Field(i)
+			if field.Type() != reflect.TypeOf(token.NoPos) || !field.CanSet() {
+				continue
+			}
+			//The printer only prints the ... of a call if its position is valid
+			if value.Type().Field(i).Name == "Ellipsis" && field.Int() != int64(token.NoPos) {
+				field.SetInt(1)
+				continue
+			}
+			field.SetInt(int64(token.NoPos))
+		}
+		return true
+	})
+}
+
+// Returns true if the error metrics of any query or of the transactions are recorded with an error.type
+func usesClassifyError(foundFunctions []string, options *packageOptions) bool {
+	if options.txHelper() {
+		return true
+	}
+	for _, function := range foundFunctions {
+		queryOptions := options.query(function)
+		if queryOptions.ErrorMetrics || (queryOptions.Semconv && queryOptions.RuntimeMetrics) {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds the error.type attribute, the class of err returned by classifyQueryError, to a metric.WithAttributes call
+func withErrorType(attributes ast.Expr) ast.Expr {
+	return withAttribute(attributes, &ast.CallExpr{
+		Fun: &ast.Ident{
+			Name: classifyErrorFunction,
+		},
+		Args: []ast.Expr{
+			&ast.Ident{
+				Name: "err",
+			},
+		},
+	})
+}
+
+// Adds the error.type attribute with the value of the errorType variable to a metric.WithAttributes call
+func withErrorTypeVariable(attributes ast.Expr) ast.Expr {
+	return withAttribute(attributes, &ast.Ident{
+		Name: "errorType",
+	})
+}
+
+func withAttribute(attributes ast.Expr, value ast.Expr) ast.Expr {
+	CallExpr := attributes.(*ast.CallExpr)
+	return &ast.CallExpr{
+		Fun: CallExpr.Fun,
+		Args: append(append([]ast.Expr{}, CallExpr.Args...), &ast.CallExpr{
+			Fun: &ast.SelectorExpr{
+				X: &ast.Ident{
+					Name: "attribute",
+				},
+				Sel: &ast.Ident{
+					Name: "String",
+				},
+			},
+			Args: []ast.Expr{
+				&ast.BasicLit{
+					Kind:  token.STRING,
+					Value: strconv.Quote("error.type"),
+				},
+				value,
+			},
+		}),
+	}
+}
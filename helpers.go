@@ -3,14 +3,32 @@ package main
 import (
 	"go/ast"
 	"go/token"
-	"regexp"
+	"path/filepath"
+	"sort"
 	"strings"
 	"unicode"
 )
 
+// Separates the words of a camel case name with underscores, keeping acronyms and digits within their word, e.g.
+// GetUserByID becomes Get_User_By_ID, HTTPServerV2Status becomes HTTP_Server_V2_Status and ListUserIDs becomes
+// List_User_IDs
 func toSnakeCase(s string) string {
-	match := regexp.MustCompilePOSIX("([a-z])([A-Z]|[0-9])|[0-9][A-Z]")
-	return match.ReplaceAllString(s, "${1}_${2}")
+	r := []rune(s)
+	var b strings.Builder
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) {
+			previous := r[i-1]
+			//A new word starts after a lower case letter or a digit, or with the last upper case letter of an acronym
+			//unless it is followed by the s of a plural, like in IDs
+			acronymEnd := unicode.IsUpper(previous) && i+1 < len(r) && unicode.IsLower(r[i+1])
+			plural := i+1 < len(r) && r[i+1] == 's' && (i+2 == len(r) || !unicode.IsLower(r[i+2]))
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (acronymEnd && !plural) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
 }
 
 func setUnexported(name string) string {
@@ -25,12 +43,56 @@ func setExported(name string) string {
 	return string(r)
 }
 
-func addModifiedComment(file *ast.File) {
+const modifiedComment = "// Modified by sqlc-metrics-generator v1.0.0"
+
+// Marks the file as modified and records the options it was modified with
+func addModifiedComment(file *ast.File, options []string) {
+	text := modifiedComment
+	if len(options) > 0 {
+		text += " with " + strings.Join(options, " ")
+	}
+	//Without a position the printer puts the comment right above the package clause, which turns the header into a
+	//package doc comment whose indented lines a later run would reformat. Behind the header it keeps the blank line
+	//sqlc leaves.
 	file.Comments[0].List = append(file.Comments[0].List, &ast.Comment{
-		Text: "// Modified by sqlc-metrics-generator v1.0.0",
+		Slash: file.Comments[0].End(),
+		Text:  text,
 	})
 }
 
+// Returns the options recorded by addModifiedComment
+func modifiedOptions(file *ast.File) []string {
+	for _, comment := range file.Comments {
+		for _, c := range comment.List {
+			if strings.HasPrefix(c.Text, modifiedComment) {
+				_, options, _ := strings.Cut(c.Text, " with ")
+				return strings.Fields(options)
+			}
+		}
+	}
+	return nil
+}
+
+// Removes the comment added by addModifiedComment
+func removeModifiedComment(file *ast.File) {
+	for i, comment := range file.Comments {
+		var list []*ast.Comment
+		for _, c := range comment.List {
+			if !strings.Contains(c.Text, "sqlc-metrics-generator") {
+				list = append(list, c)
+			}
+		}
+		file.Comments[i].List = list
+	}
+	var comments []*ast.CommentGroup
+	for _, comment := range file.Comments {
+		if len(comment.List) > 0 {
+			comments = append(comments, comment)
+		}
+	}
+	file.Comments = comments
+}
+
 func previouslyModified(file *ast.File) bool {
 	for _, comment := range file.Comments {
 		for _, c := range comment.List {
@@ -60,11 +122,21 @@ func addMissingImports(file *ast.File, imports []string) {
 	}
 	for i, decl := range file.Decls {
 		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.IMPORT {
-			for imp, _ := range requiredImports {
+			for _, imp := range imports {
+				if !requiredImports[imp] {
+					continue
+				}
+				//Without a position, the printer would move a comment following the imports between them. The position of
+				//the last import keeps them in the block without a blank line.
+				pos := GenDecl.Rparen
+				if len(GenDecl.Specs) > 0 {
+					pos = GenDecl.Specs[len(GenDecl.Specs)-1].Pos()
+				}
 				file.Decls[i].(*ast.GenDecl).Specs = append(file.Decls[i].(*ast.GenDecl).Specs, &ast.ImportSpec{
 					Path: &ast.BasicLit{
-						Kind:  token.STRING,
-						Value: "\"" + imp + "\"",
+						ValuePos: pos,
+						Kind:     token.STRING,
+						Value:    "\"" + imp + "\"",
 					},
 				},
 				)
@@ -72,3 +144,78 @@ func addMissingImports(file *ast.File, imports []string) {
 		}
 	}
 }
+
+// Removes the given imports, if the package is no longer referenced anywhere in the file. This is used to undo
+// addMissingImports without touching imports sqlc itself needs.
+func removeUnusedImports(file *ast.File, imports []string) {
+	candidates := map[string]bool{}
+	for _, imp := range imports {
+		candidates[imp] = true
+	}
+	used := map[string]bool{}
+	ast.Inspect(file, func(node ast.Node) bool {
+		if SelectorExpr, ok := node.(*ast.SelectorExpr); ok {
+			if Ident, ok := SelectorExpr.X.(*ast.Ident); ok {
+				used[Ident.Name] = true
+			}
+		}
+		return true
+	})
+	for _, decl := range file.Decls {
+		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.IMPORT {
+			var specs []ast.Spec
+			removedPos := token.NoPos
+			for _, spec := range GenDecl.Specs {
+				ImportSpec := spec.(*ast.ImportSpec)
+				path := strings.ReplaceAll(ImportSpec.Path.Value, "\"", "")
+				name := path[strings.LastIndex(path, "/")+1:]
+				if ImportSpec.Name != nil {
+					name = ImportSpec.Name.Name
+				}
+				if candidates[path] && !used[name] {
+					if !removedPos.IsValid() {
+						removedPos = ImportSpec.Pos()
+					}
+					continue
+				}
+				//The added imports are sorted in between the ones of sqlc, so the import following the removed ones takes
+				//their place. Otherwise the printer would leave a blank line for the lines they took.
+				if removedPos.IsValid() {
+					if ImportSpec.Name != nil {
+						ImportSpec.Name.NamePos = removedPos
+					}
+					ImportSpec.Path.ValuePos = removedPos
+					removedPos = token.NoPos
+				}
+				specs = append(specs, spec)
+			}
+			GenDecl.Specs = specs
+		}
+	}
+}
+
+// Removes all function declarations for which remove returns true
+func removeFunctions(file *ast.File, remove func(FuncDecl *ast.FuncDecl) bool) {
+	var decls []ast.Decl
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && remove(FuncDecl) {
+			continue
+		}
+		decls = append(decls, decl)
+	}
+	file.Decls = decls
+}
+
+// Returns the names of all sqlc query files (*.sql.go) in the given directory
+func findQueryFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(path, "*.sql.go"))
+	if err != nil {
+		return nil, err
+	}
+	var filenames []string
+	for _, match := range matches {
+		filenames = append(filenames, filepath.Base(match))
+	}
+	sort.Strings(filenames)
+	return filenames, nil
+}
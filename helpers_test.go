@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestToSnakeCase(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"GetUser", "Get_User"},
+		{"GetUserByID", "Get_User_By_ID"},
+		{"HTTPServerV2Status", "HTTP_Server_V2_Status"},
+		{"ListUserIDs", "List_User_IDs"},
+		{"ListV2UserIDs", "List_V2_User_IDs"},
+		{"ListIDsByName", "List_IDs_By_Name"},
+		{"getUser", "get_User"},
+		{"ID", "ID"},
+		{"A", "A"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := toSnakeCase(test.name); got != test.want {
+				t.Errorf("toSnakeCase(%q) = %q, want %q", test.name, got, test.want)
+			}
+		})
+	}
+}
@@ -4,70 +4,429 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"go/ast"
 	"go/parser"
 	"go/printer"
 	"go/token"
-	"log"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
+// Matches the configuration used by gofmt, so the output looks like the code generated by sqlc
+var printerConfig = printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+
 func main() {
-	var foundFunctions []string
+	var outputs []outputFile
+	var problems []error
 	var err error
 
+	//sqlc runs process plugins with the method of the codegen service as their only argument
+	if len(os.Args) == 2 && os.Args[1] == pluginMethod {
+		if err := runPlugin(os.Stdin, os.Stdout); err != nil {
+			exit("text", err)
+		}
+		exit("text")
+	}
+
 	path := flag.String("path", "", "The path to the sqlc output folder")
 	queryFilename := flag.String("queryFilename", "query.sql.go", "The name of the query file")
 	dbFilename := flag.String("dbFilename", "db.go", "The name of the db file")
+	allQueryFiles := flag.Bool("allQueryFiles", false, "Set to instrument every *.sql.go file in the path instead of only queryFilename")
+	sqlcConfigFilename := flag.String("sqlcConfig", "", "The path to a sqlc.yaml or sqlc.json, set to instrument every Go package it generates instead of the one in path")
 	generateInvocationMetrics := flag.Bool("generateInvocationMetrics", false, "Set if invocation metrics should be generated")
 	generateErrorMetrics := flag.Bool("generateErrorMetrics", false, "Set if error metrics should be generated")
 	generateQueryRuntimeMetrics := flag.Bool("generateQueryRuntimeMetrics", false, "Set if runtime metrics should be generated")
+	generateRowMetrics := flag.Bool("generateRowMetrics", false, "Set to record the number of rows returned or affected by :many, :execrows and :execresult queries")
+	generateInFlightMetrics := flag.Bool("generateInFlightMetrics", false, "Set to count the calls of each query that have not returned yet")
+	excludeNoRowsErrors := flag.Bool("excludeNoRowsErrors", false, "Set to not count errors that only mean a query returned no rows, like sql.ErrNoRows")
+	runtimeBuckets := flag.String("runtimeBuckets", "", "Comma separated bucket boundaries of the runtime histogram in seconds")
+	generateRuntimeGauge := flag.Bool("generateRuntimeGauge", false, "Set to additionally record the runtime on the gauge used by older versions")
+	sharedInstruments := flag.Bool("sharedInstruments", false, "Set to record all queries on one instrument per metric, distinguished by the db.query.name attribute")
+	semconv := flag.Bool("semconv", false, "Set to follow the OpenTelemetry database semantic conventions, implies -sharedInstruments")
+	nameTemplate := flag.String("nameTemplate", defaultNameTemplate, "The text/template the metric names are built from, using .Basename, .Query, .Kind and .Separator and the functions snake, lower and upper")
+	separator := flag.String("separator", "_", "The separator used between the parts of the metric names")
 	generateConnectionRetriever := flag.Bool("generateConnectionRetriever", false, "Set to generate a convince function to retrieve the underlying database connection")
+	generateAttributeExtractor := flag.Bool("generateAttributeExtractor", false, "Set to let New accept a function returning attributes from the context, which are recorded with every metric")
+	generateTraces := flag.Bool("generateTraces", false, "Set to start a span for every call of a query with the tracer provider passed to New")
+	generateTxHelper := flag.Bool("generateTxHelper", false, "Set to generate RunInTx, which records the duration, the outcome and the number of queries of transactions")
+	txRetries := flag.Int("txRetries", 0, "How often RunInTx retries a transaction that failed with a serialization failure")
+	dryRun := flag.Bool("dryRun", false, "Set to print a unified diff of the changes instead of writing the files")
+	check := flag.Bool("check", false, "Set to only check that the files are instrumented with the given options and exit non-zero if not")
+	uninstrument := flag.Bool("uninstrument", false, "Set to remove all instrumentation and restore the files generated by sqlc")
+	format := flag.String("format", "text", "The format of the reported errors, either text or json")
+	configFilename := flag.String("config", "", "The path to the config file, by default sqlc-metrics.yaml next to sqlc.yaml is used if it exists")
 	flag.Parse()
 
+	//Flags that were passed explicitly override the config file
+	var flags settings
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "generateInvocationMetrics":
+			flags.InvocationMetrics = generateInvocationMetrics
+		case "generateErrorMetrics":
+			flags.ErrorMetrics = generateErrorMetrics
+		case "generateQueryRuntimeMetrics":
+			flags.RuntimeMetrics = generateQueryRuntimeMetrics
+		case "generateRowMetrics":
+			flags.RowMetrics = generateRowMetrics
+		case "generateInFlightMetrics":
+			flags.InFlightMetrics = generateInFlightMetrics
+		case "excludeNoRowsErrors":
+			flags.ExcludeNoRows = excludeNoRowsErrors
+		case "runtimeBuckets":
+			flags.RuntimeBuckets, err = parseBuckets(*runtimeBuckets)
+		case "generateRuntimeGauge":
+			flags.RuntimeGauge = generateRuntimeGauge
+		case "sharedInstruments":
+			flags.SharedInstruments = sharedInstruments
+		case "semconv":
+			flags.Semconv = semconv
+		case "nameTemplate":
+			flags.NameTemplate = nameTemplate
+		case "separator":
+			flags.Separator = separator
+		case "generateConnectionRetriever":
+			flags.ConnectionRetriever = generateConnectionRetriever
+		case "generateAttributeExtractor":
+			flags.AttributeExtractor = generateAttributeExtractor
+		case "generateTraces":
+			flags.Traces = generateTraces
+		case "generateTxHelper":
+			flags.TxHelper = generateTxHelper
+		case "txRetries":
+			flags.TxRetries = txRetries
+		}
+	})
+
+	if *format != "text" && *format != "json" {
+		exit("text", newError(usageError, token.Position{}, "", "unknown format %q, expected text or json", *format))
+	}
+	if err == nil {
+		err = flags.validate()
+	}
+	if err != nil {
+		exit(*format, newError(usageError, token.Position{}, "", "%w", err))
+	}
 	if path == nil {
 		s := ""
 		path = &s
 	}
-	fset := token.NewFileSet()
-	file, err := parser.ParseFile(fset, *path+*queryFilename, nil, parser.ParseComments)
+	if *check && *uninstrument {
+		exit(*format, newError(usageError, token.Position{}, "", "-check and -uninstrument can not be combined"))
+	}
+
+	//Without a sqlc config, only the package in path is processed. Its settings are taken from the sqlc config
+	//generating it, if there is one.
+	p := findSqlcPackage(*path)
+	p.Path, p.OutputDbFileName = *path, *dbFilename
+	packages := []sqlcPackage{p}
+	configPath := *path
+	if *sqlcConfigFilename != "" {
+		packages, err = loadSqlcConfig(*sqlcConfigFilename)
+		if err != nil {
+			exit(*format, err)
+		}
+		configPath = filepath.Dir(*sqlcConfigFilename)
+	}
+	c, err := loadConfig(*configFilename, configPath)
 	if err != nil {
-		fmt.Println(err)
-		return
+		exit(*format, err)
+	}
+
+	for _, p := range packages {
+		options := newPackageOptions(c, p.Path, flags)
+		options.sqlc = p
+		if !*uninstrument && !options.anyMetricEnabled() {
+			exit(*format, newError(usageError, token.Position{Filename: p.Path}, "", "at least one of the metrics or traces needs to be set to true, otherwise this tool does not make sense"))
+		}
+
+		queryFilenames := []string{*queryFilename}
+		if *allQueryFiles || *sqlcConfigFilename != "" {
+			queryFilenames, err = findQueryFiles(p.Path)
+			if err != nil {
+				exit(*format, newError(usageError, token.Position{}, "", "%w", err))
+			}
+			if len(queryFilenames) == 0 {
+				exit(*format, newError(usageError, token.Position{}, "", "no *.sql.go files found in %q", p.Path))
+			}
+		}
+
+		packageOutputs, errs := processPackage(p.Path, queryFilenames, p.OutputDbFileName, p.OutputBatchFileName, p.OutputCopyfromFileName, options, *check, *uninstrument)
+		if len(errs) > 0 && !*check {
+			exit(*format, errs...)
+		}
+		problems = append(problems, errs...)
+		outputs = append(outputs, packageOutputs...)
 	}
-	if !*generateInvocationMetrics && !*generateErrorMetrics && !*generateQueryRuntimeMetrics {
-		fmt.Println("At least one of the metrics needs to be set to true, otherwise this tool does not make sense")
-		return
+	if *check {
+		exit(*format, problems...)
 	}
-	file, foundFunctions, err = modifyQuerySqlFile(file, *generateInvocationMetrics, *generateErrorMetrics, *generateQueryRuntimeMetrics)
+
+	err = writeFiles(outputs, *dryRun)
 	if err != nil {
-		fmt.Println(err)
-		return
+		exit(*format, err)
+	}
+	exit(*format)
+}
+
+// Instruments the query files, the batch and the copyfrom file, if there are any, and the db file of the package in path and returns the
+// modified files. If check is set, nothing is modified and the problems found are returned instead. If uninstrument is
+// set, the instrumentation is removed.
+func processPackage(path string, queryFilenames []string, dbFilename, batchFilename, copyfromFilename string, options *packageOptions, check, uninstrument bool) ([]outputFile, []error) {
+	var foundFunctions []string
+	var problems []error
+	var outputs []outputFile
+
+	for _, queryFilename := range queryFilenames {
+		filename := filepath.Join(path, queryFilename)
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, []error{fileError(filename, err)}
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+		if err != nil {
+			return nil, parseErrors(filename, err)
+		}
+		if check {
+			fileProblems, functions, err := checkQuerySqlFile(fset, file, options)
+			if err != nil {
+				return nil, []error{err}
+			}
+			problems = append(problems, fileProblems...)
+			foundFunctions = append(foundFunctions, functions...)
+			continue
+		}
+		if uninstrument {
+			if previouslyModified(file) {
+				stripQuerySqlFile(file)
+			}
+		} else {
+			var functions []string
+			file, functions, err = modifyQuerySqlFile(fset, file, options)
+			if err != nil {
+				return nil, []error{err}
+			}
+			foundFunctions = append(foundFunctions, functions...)
+		}
+
+		output, err := printFile(fset, file, filename)
+		if err != nil {
+			return nil, []error{err}
+		}
+		outputs = append(outputs, outputFile{filename: filename, original: src, output: output})
 	}
 
-	output := bytes.NewBuffer([]byte{})
-	if err := printer.Fprint(output, fset, file); err != nil {
-		log.Fatal(err)
+	//sqlc only generates the batch file for packages with batch queries
+	var batchQueries []string
+	filename := filepath.Join(path, batchFilename)
+	src, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, []error{fileError(filename, err)}
+	}
+	if err == nil {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+		if err != nil {
+			return nil, parseErrors(filename, err)
+		}
+		switch {
+		case check:
+			fileProblems, queries, err := checkBatchFile(fset, file, options)
+			if err != nil {
+				return nil, []error{err}
+			}
+			problems = append(problems, fileProblems...)
+			batchQueries = queries
+		case uninstrument:
+			if previouslyModified(file) {
+				stripBatchFile(file)
+			}
+		default:
+			file, batchQueries, err = modifyBatchFile(fset, file, options)
+			if err != nil {
+				return nil, []error{err}
+			}
+		}
+		if !check {
+			output, err := printFile(fset, file, filename)
+			if err != nil {
+				return nil, []error{err}
+			}
+			outputs = append(outputs, outputFile{filename: filename, original: src, output: output})
+		}
+	}
+
+	//sqlc only generates the copyfrom file for packages with copyfrom queries
+	filename = filepath.Join(path, copyfromFilename)
+	src, err = os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, []error{fileError(filename, err)}
+	}
+	if err == nil {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+		if err != nil {
+			return nil, parseErrors(filename, err)
+		}
+		switch {
+		case check:
+			fileProblems, functions, err := checkCopyfromFile(fset, file, options)
+			if err != nil {
+				return nil, []error{err}
+			}
+			problems = append(problems, fileProblems...)
+			foundFunctions = append(foundFunctions, functions...)
+		case uninstrument:
+			if previouslyModified(file) {
+				stripCopyfromFile(file)
+			}
+		default:
+			var functions []string
+			file, functions, err = modifyCopyfromFile(fset, file, options)
+			if err != nil {
+				return nil, []error{err}
+			}
+			foundFunctions = append(foundFunctions, functions...)
+		}
+		if !check {
+			output, err := printFile(fset, file, filename)
+			if err != nil {
+				return nil, []error{err}
+			}
+			outputs = append(outputs, outputFile{filename: filename, original: src, output: output})
+		}
 	}
-	err = os.WriteFile(*path+*queryFilename, output.Bytes(), 0666)
+
+	filename = filepath.Join(path, dbFilename)
+	src, err = os.ReadFile(filename)
+	if err != nil {
+		return nil, []error{fileError(filename, err)}
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, parseErrors(filename, err)
+	}
+	if !uninstrument {
+		if err := validateSqlcPackage(fset, file, options.sqlc); err != nil {
+			return nil, []error{err}
+		}
+	}
+	if check {
+		return nil, append(problems, checkDbFile(fset, file, foundFunctions, batchQueries, options)...)
+	}
+	if uninstrument {
+		if previouslyModified(file) {
+			stripDbFile(file)
+		}
+	} else {
+		file, err = modifyDbFile(fset, file, foundFunctions, batchQueries, options)
+		if err != nil {
+			return nil, []error{err}
+		}
+	}
+	output, err := printFile(fset, file, filename)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return nil, []error{err}
 	}
+	return append(outputs, outputFile{filename: filename, original: src, output: output}), nil
+}
 
-	fset = token.NewFileSet()
-	file, err = parser.ParseFile(fset, *path+*dbFilename, nil, parser.ParseComments)
+// Prints the file like gofmt. The imports are sorted, because the missing ones are appended to the import block.
+func printFile(fset *token.FileSet, file *ast.File, filename string) ([]byte, error) {
+	ast.SortImports(fset, file)
+	var output bytes.Buffer
+	if err := printerConfig.Fprint(&output, fset, file); err != nil {
+		return nil, newError(unsupportedError, token.Position{Filename: filename}, "", "%w", err)
+	}
+	return output.Bytes(), nil
+}
+
+// Reports the errors to stderr and exits with the exit code of the first one, or zero if there are none
+func exit(format string, errs ...error) {
+	os.Exit(reportErrors(os.Stderr, format, errs))
+}
+
+type outputFile struct {
+	filename string
+	original []byte
+	output   []byte
+}
+
+// Writes all files, or prints a unified diff against their original content if dryRun is set. Every file is first
+// written to a temporary file next to it, together with a backup of its original content, and only once all of them
+// were written successfully they are renamed over the originals. If a rename fails, the files renamed before it are
+// restored from their backups. A file that cannot be restored either is reported with the backup that is kept of it.
+func writeFiles(files []outputFile, dryRun bool) error {
+	if dryRun {
+		for _, file := range files {
+			fmt.Print(unifiedDiff(file.filename, file.original, file.output))
+		}
+		return nil
+	}
+
+	var tempFilenames []string
+	removeTempFiles := func() {
+		for _, tempFilename := range tempFilenames {
+			if tempFilename != "" {
+				os.Remove(tempFilename)
+			}
+		}
+	}
+	//The outputs are at even and the backups of the originals at odd indices
+	for _, file := range files {
+		for _, content := range [][]byte{file.output, file.original} {
+			tempFilename, err := writeTempFile(file.filename, content)
+			if err != nil {
+				removeTempFiles()
+				return fileError(file.filename, err)
+			}
+			tempFilenames = append(tempFilenames, tempFilename)
+		}
+	}
+	for i, file := range files {
+		if err := os.Rename(tempFilenames[2*i], file.filename); err != nil {
+			var unrestored []string
+			for j := i - 1; j >= 0; j-- {
+				if os.Rename(tempFilenames[2*j+1], files[j].filename) != nil {
+					unrestored = append(unrestored, files[j].filename+" (original kept in "+tempFilenames[2*j+1]+")")
+					tempFilenames[2*j+1] = ""
+				}
+			}
+			removeTempFiles()
+			if len(unrestored) > 0 {
+				err = fmt.Errorf("%w, the files written before could not be restored: %s", err, strings.Join(unrestored, ", "))
+			}
+			return fileError(file.filename, err)
+		}
+		tempFilenames[2*i] = ""
+	}
+	removeTempFiles()
+	return nil
+}
+
+// Writes the content to a temporary file in the same directory as filename, with the same permissions
+func writeTempFile(filename string, content []byte) (string, error) {
+	info, err := os.Stat(filename)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return "", err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = temp.Write(content)
+	if err == nil {
+		err = temp.Chmod(info.Mode().Perm())
 	}
-	file = modifyDbFile(file, foundFunctions, *generateInvocationMetrics, *generateErrorMetrics, *generateQueryRuntimeMetrics, *generateConnectionRetriever)
-	output = bytes.NewBuffer([]byte{})
-	if err = printer.Fprint(output, fset, file); err != nil {
-		log.Fatal(err)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
 	}
-	err = os.WriteFile(*path+*dbFilename, output.Bytes(), 0666)
 	if err != nil {
-		fmt.Println(err)
-		return
+		os.Remove(temp.Name())
+		return "", err
 	}
+	return temp.Name(), nil
 }
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Set to update the golden files in testdata/golden")
+
+// The flags the pgx fixture is instrumented with, enabling everything the package supports
+func pgxFlags() settings {
+	enabled := true
+	return settings{
+		InvocationMetrics:  &enabled,
+		ErrorMetrics:       &enabled,
+		RuntimeMetrics:     &enabled,
+		RowMetrics:         &enabled,
+		InFlightMetrics:    &enabled,
+		AttributeExtractor: &enabled,
+		Traces:             &enabled,
+		TxHelper:           &enabled,
+	}
+}
+
+// Processes the package in dir like main does
+func processDir(t *testing.T, dir string, flags settings, check, uninstrument bool) ([]outputFile, []error) {
+	t.Helper()
+	p := findSqlcPackage(dir)
+	p.Path = dir
+	c, err := loadConfig("", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := newPackageOptions(c, dir, flags)
+	options.sqlc = p
+	queryFilenames, err := findQueryFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return processPackage(dir, queryFilenames, p.OutputDbFileName, p.OutputBatchFileName, p.OutputCopyfromFileName, options, check, uninstrument)
+}
+
+// Instruments or uninstruments the package in dir like main does and writes the files
+func runPackage(t *testing.T, dir string, flags settings, uninstrument bool) {
+	t.Helper()
+	outputs, errs := processDir(t, dir, flags, false, uninstrument)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if err := writeFiles(outputs, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Returns the content of every file in dir
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[entry.Name()] = string(content)
+	}
+	return files
+}
+
+// Copies the files of the fixtures in testdata to dir
+func copyFixtures(t *testing.T, dir string, fixtures ...string) {
+	t.Helper()
+	for _, fixture := range fixtures {
+		for name, content := range readFiles(t, filepath.Join("testdata", fixture)) {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// Runs the go command in dir, the fixture testdata/module provides the go.mod of the instrumented packages
+func runGo(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("builds the instrumented package with the go command")
+	}
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go %v: %v:\n%s", args, err, output)
+	}
+}
+
+// Compares the files of two directories
+func compareFiles(t *testing.T, step string, got, want map[string]string) {
+	t.Helper()
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("%s: %s differs:\n%s", step, name, unifiedDiff(name, []byte(content), []byte(got[name])))
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%s: unexpected file %s", step, name)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	enabled := true
+	tests := []struct {
+		fixture string
+		flags   settings
+	}{
+		{"pgx", pgxFlags()},
+		{"prepared", settings{
+			InvocationMetrics: &enabled,
+			ErrorMetrics:      &enabled,
+			RuntimeMetrics:    &enabled,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			original := readFiles(t, filepath.Join("testdata", test.fixture))
+			dir := t.TempDir()
+			copyFixtures(t, dir, test.fixture)
+
+			runPackage(t, dir, test.flags, false)
+			instrumented := readFiles(t, dir)
+			golden := filepath.Join("testdata", "golden", test.fixture)
+			if *update {
+				if err := os.MkdirAll(golden, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				for name, content := range instrumented {
+					if err := os.WriteFile(filepath.Join(golden, name), []byte(content), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			compareFiles(t, "instrument", instrumented, readFiles(t, golden))
+
+			//Instrumenting the output again yields the same files
+			runPackage(t, dir, test.flags, false)
+			compareFiles(t, "instrument again", readFiles(t, dir), instrumented)
+
+			//Uninstrumenting yields the files sqlc generated
+			runPackage(t, dir, settings{}, true)
+			compareFiles(t, "uninstrument", readFiles(t, dir), original)
+		})
+	}
+}
+
+func TestWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.sql.go")
+	second := filepath.Join(dir, "db.go")
+	if err := os.WriteFile(first, []byte("original a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("original db\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files := []outputFile{
+		{filename: first, original: []byte("original a\n"), output: []byte("instrumented a\n")},
+		{filename: second, original: []byte("original db\n"), output: []byte("instrumented db\n")},
+	}
+	if err := writeFiles(files, false); err != nil {
+		t.Fatal(err)
+	}
+	compareFiles(t, "write", readFiles(t, dir), map[string]string{"a.sql.go": "instrumented a\n", "db.go": "instrumented db\n"})
+	if info, err := os.Stat(first); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("permissions of %s are not kept: %v, %v", first, info.Mode(), err)
+	}
+}
+
+func TestWriteFilesRestore(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.sql.go")
+	if err := os.WriteFile(first, []byte("original a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	//A file can not be renamed over a directory that is not empty, so the second rename fails
+	second := filepath.Join(dir, "db.go")
+	if err := os.MkdirAll(filepath.Join(second, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := []outputFile{
+		{filename: first, original: []byte("original a\n"), output: []byte("instrumented a\n")},
+		{filename: second, original: []byte("original db\n"), output: []byte("instrumented db\n")},
+	}
+	err := writeFiles(files, false)
+	var generatorErr *generatorError
+	if !errors.As(err, &generatorErr) || generatorErr.Kind != ioError || generatorErr.Position.Filename != second {
+		t.Fatalf("writeFiles() = %v, want an io error for %s", err, second)
+	}
+	if strings.Contains(err.Error(), "could not be restored") {
+		t.Errorf("writeFiles() = %v, want the first file to be restored", err)
+	}
+
+	//The first file is restored and neither temporary files nor backups are left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !slices.Equal(names, []string{"a.sql.go", "db.go"}) {
+		t.Errorf("files after the failed write = %v, want only a.sql.go and db.go", names)
+	}
+	if content, err := os.ReadFile(first); err != nil || string(content) != "original a\n" {
+		t.Errorf("%s = %q, %v, want the original content", first, content, err)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// The template metric names are built from if none is configured
+const defaultNameTemplate = "{{.Basename}}{{.Separator}}{{.Query | snake}}{{.Separator}}{{.Kind}}"
+
+// Stands in for the basename while rendering the template, since the basename is only known when New is called
+const basenameMarker = "\x00"
+
+// The instrument name syntax of OpenTelemetry
+var otelNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.\-/]{0,254}$`)
+
+// The characters Prometheus exporters replace with an underscore
+var prometheusReplacedPattern = regexp.MustCompile(`[^A-Za-z0-9_:]`)
+
+// The values a naming template can use
+type nameData struct {
+	// The basename passed to New
+	Basename string
+	// The name of the query, or query for instruments shared by all queries
+	Query string
+	// What the instrument measures, e.g. call_counter, joined with the separator
+	Kind string
+	// The separator, _ by default
+	Separator string
+}
+
+var nameTemplateFuncs = template.FuncMap{
+	"snake": func(s string) string {
+		return strings.ToLower(toSnakeCase(s))
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// Parses a naming template, so invalid templates are rejected before anything is generated
+func parseNameTemplate(text string) (*template.Template, error) {
+	return template.New("name").Funcs(nameTemplateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// Returns the name of the metric of the given kind for the query, with basenameMarker in place of the basename
+func (q queryOptions) metricName(function string, kind ...string) (string, error) {
+	t, err := parseNameTemplate(q.NameTemplate)
+	if err != nil {
+		return "", err
+	}
+	data := nameData{
+		Basename:  basenameMarker,
+		Query:     function,
+		Kind:      strings.Join(kind, q.Separator),
+		Separator: q.Separator,
+	}
+	if q.NameOverride {
+		data.Query = q.Name
+	}
+	if q.SharedInstruments {
+		data.Query = "query"
+	}
+	var name strings.Builder
+	if err := t.Execute(&name, data); err != nil {
+		return "", err
+	}
+	return name.String(), nil
+}
+
+// Returns the expression building the metric name at runtime, the basename passed to New is inserted where the
+// template uses it
+func metricNameExpr(name string) ast.Expr {
+	parts := strings.Split(name, basenameMarker)
+	var expr ast.Expr
+	for i, part := range parts {
+		if i > 0 {
+			basename := &ast.SelectorExpr{
+				X: &ast.Ident{
+					Name: "q",
+				},
+				Sel: &ast.Ident{
+					Name: "basename",
+				},
+			}
+			if expr == nil {
+				expr = basename
+			} else {
+				expr = &ast.BinaryExpr{X: expr, Op: token.ADD, Y: basename}
+			}
+		}
+		if part == "" {
+			continue
+		}
+		literal := &ast.BasicLit{
+			Kind:  token.STRING,
+			Value: strconv.Quote(part),
+		}
+		if expr == nil {
+			expr = literal
+		} else {
+			expr = &ast.BinaryExpr{X: expr, Op: token.ADD, Y: literal}
+		}
+	}
+	if expr == nil {
+		return &ast.BasicLit{Kind: token.STRING, Value: `""`}
+	}
+	if _, ok := expr.(*ast.BinaryExpr); ok {
+		return &ast.ParenExpr{X: expr}
+	}
+	return expr
+}
+
+// Checks that the names of all instruments of the enabled metrics are valid OpenTelemetry instrument names and stay
+// distinct once a Prometheus exporter replaces the characters it does not allow. The basename configured for the
+// package is used, other basenames passed to New at runtime can not be checked.
+func validateMetricNames(fset *token.FileSet, file *ast.File, foundFunctions, batchQueries []string, options *packageOptions) error {
+	//Without .Kind the instruments of a query share a name, without .Query the ones of different queries and of the
+	//transactions, statements and batches, which use it for their name as well
+	fields, err := nameTemplateFields(options.query("").NameTemplate)
+	if err != nil {
+		return newError(usageError, fset.Position(file.Package), "", "invalid name template: %w", err)
+	}
+	requireFields := func(function string, query bool) error {
+		if !fields["Kind"] {
+			return newError(usageError, fset.Position(file.Package), function, "name template does not use .Kind, the instruments of a query would share one name")
+		}
+		if query && !fields["Query"] {
+			return newError(usageError, fset.Position(file.Package), function, "name template does not use .Query, the instruments of different queries would share one name")
+		}
+		return nil
+	}
+	names := map[string]string{}
+	prometheusNames := map[string]string{}
+	check := func(function, name, instrument string) error {
+		name = strings.ReplaceAll(name, basenameMarker, options.basename())
+		if !otelNamePattern.MatchString(name) {
+			return newError(usageError, fset.Position(file.Package), function, "metric name %q is not a valid OpenTelemetry instrument name", name)
+		}
+		if other, ok := names[name]; ok && other != instrument {
+			return newError(usageError, fset.Position(file.Package), function, "metric name %q is used by more than one instrument", name)
+		}
+		names[name] = instrument
+		prometheusName := prometheusReplacedPattern.ReplaceAllString(name, "_")
+		if other, ok := prometheusNames[prometheusName]; ok && other != name {
+			return newError(usageError, fset.Position(file.Package), function, "metric names %q and %q are both exported as %q to Prometheus", other, name, prometheusName)
+		}
+		prometheusNames[prometheusName] = name
+		return nil
+	}
+	for _, function := range foundFunctions {
+		queryOptions := options.query(function)
+		//The Queries field suffix and the kind of every instrument of the query
+		var kinds []struct {
+			suffix string
+			kind   []string
+		}
+		add := func(suffix string, kind ...string) {
+			kinds = append(kinds, struct {
+				suffix string
+				kind   []string
+			}{suffix, kind})
+		}
+		if queryOptions.RuntimeMetrics && !queryOptions.Semconv {
+			add("RuntimeHistogram", "runtime", "histogram")
+		}
+		if queryOptions.RuntimeMetrics && queryOptions.RuntimeGauge {
+			add("RuntimeGauge", "runtime", "gauge")
+		}
+		if queryOptions.InvocationMetrics {
+			add("InvocationCounter", "call", "counter")
+		}
+		if queryOptions.ErrorMetrics {
+			add("ErrorCounter", "error", "counter")
+		}
+		if queryOptions.rowMetrics() {
+			add("RowsHistogram", "rows", "histogram")
+		}
+		if queryOptions.inputRowMetrics() {
+			add("InputRowsHistogram", "input_rows", "histogram")
+		}
+		if queryOptions.InFlightMetrics {
+			add("InFlightCounter", "in_flight", "counter")
+		}
+		if len(kinds) > 0 {
+			if err := requireFields(function, !queryOptions.SharedInstruments); err != nil {
+				return err
+			}
+		}
+		for _, kind := range kinds {
+			name, err := queryOptions.metricName(function, kind.kind...)
+			if err != nil {
+				return newError(usageError, fset.Position(file.Package), function, "invalid name template: %w", err)
+			}
+			if err := check(function, name, queryOptions.field(function, kind.suffix)); err != nil {
+				return err
+			}
+		}
+	}
+	if options.txHelper() {
+		if err := requireFields("", true); err != nil {
+			return err
+		}
+		for _, instrument := range txInstruments(options) {
+			name, err := options.packageMetricName(txMetricName, instrument.kind...)
+			if err != nil {
+				return newError(usageError, fset.Position(file.Package), "", "invalid name template: %w", err)
+			}
+			if err := check("", name, instrument.field); err != nil {
+				return err
+			}
+		}
+	}
+	if findPrepare(file) != nil {
+		if err := requireFields("", true); err != nil {
+			return err
+		}
+		for _, instrument := range prepareInstruments() {
+			name, err := options.packageMetricName(prepareMetricName, instrument.kind...)
+			if err != nil {
+				return newError(usageError, fset.Position(file.Package), "", "invalid name template: %w", err)
+			}
+			if err := check("", name, instrument.field); err != nil {
+				return err
+			}
+		}
+	}
+	if len(batchQueries) > 0 {
+		if err := requireFields("", true); err != nil {
+			return err
+		}
+		for _, instrument := range batchInstruments(options) {
+			name, err := options.packageMetricName(batchMetricName, instrument.kind...)
+			if err != nil {
+				return newError(usageError, fset.Position(file.Package), "", "invalid name template: %w", err)
+			}
+			if err := check("", name, instrument.field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the fields of nameData a naming template uses, e.g. Kind for {{.Kind}}
+func nameTemplateFields(text string) (map[string]bool, error) {
+	t, err := parseNameTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]bool{}
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch node := node.(type) {
+		case *parse.ListNode:
+			if node != nil {
+				for _, child := range node.Nodes {
+					walk(child)
+				}
+			}
+		case *parse.ActionNode:
+			walk(node.Pipe)
+		case *parse.PipeNode:
+			if node != nil {
+				for _, cmd := range node.Cmds {
+					walk(cmd)
+				}
+			}
+		case *parse.CommandNode:
+			for _, arg := range node.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			fields[node.Ident[0]] = true
+		case *parse.ChainNode:
+			walk(node.Node)
+		case *parse.IfNode:
+			walk(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.RangeNode:
+			walk(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.WithNode:
+			walk(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		}
+	}
+	walk(t.Tree.Root)
+	return fields, nil
+}
+
+// Returns an error if the separator can not be part of a metric name
+func validateSeparator(separator string) error {
+	if separator != "" && !regexp.MustCompile(`^[A-Za-z0-9_.\-/]+$`).MatchString(separator) {
+		return fmt.Errorf("separator %q can not be part of a metric name", separator)
+	}
+	return nil
+}
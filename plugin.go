@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The argument sqlc passes to a process plugin, the method of the codegen service it calls
+const pluginMethod = "/plugin.CodegenService/Generate"
+
+// The options of the codegen entry in the sqlc config that runs the generator as a plugin
+type pluginOptions struct {
+	// The command of the plugin generating the Go code, sqlc-gen-go by default
+	Plugin string `yaml:"plugin"`
+	// The options passed on to that plugin
+	Go map[string]any `yaml:"go"`
+	// The settings of the package, like the ones of a package in the config file
+	Metrics packageSettings `yaml:"metrics"`
+}
+
+// The options of sqlc-gen-go that affect the instrumentation
+type pluginGoOptions struct {
+	SqlPackage                string `yaml:"sql_package"`
+	EmitPreparedQueries       bool   `yaml:"emit_prepared_queries"`
+	EmitMethodsWithDbArgument bool   `yaml:"emit_methods_with_db_argument"`
+	OutputDbFileName          string `yaml:"output_db_file_name"`
+	OutputBatchFileName       string `yaml:"output_batch_file_name"`
+	OutputCopyfromFileName    string `yaml:"output_copyfrom_file_name"`
+	OutputFilesSuffix         string `yaml:"output_files_suffix"`
+}
+
+// Runs the generator as a sqlc process plugin. sqlc passes plugins its catalog and queries instead of Go code, so the
+// request is passed on to the plugin generating the Go code, whose files are instrumented before they are returned to
+// sqlc.
+func runPlugin(stdin io.Reader, stdout io.Writer) error {
+	request, err := io.ReadAll(stdin)
+	if err != nil {
+		return newError(ioError, token.Position{Filename: "stdin"}, "", "%w", err)
+	}
+
+	//The plugin options are converted to JSON by sqlc, which the YAML parser reads as well
+	var rawOptions []byte
+	var engine string
+	err = readProtoFields(request, func(field int, value []byte) error {
+		switch field {
+		case 1:
+			return readProtoFields(value, func(field int, value []byte) error {
+				if field == 2 {
+					engine = string(value)
+				}
+				return nil
+			})
+		case 5:
+			rawOptions = value
+		}
+		return nil
+	})
+	if err != nil {
+		return newError(parseError, token.Position{Filename: "stdin"}, "", "invalid codegen request: %w", err)
+	}
+	options := pluginOptions{Plugin: "sqlc-gen-go"}
+	if len(rawOptions) > 0 {
+		decoder := yaml.NewDecoder(bytes.NewReader(rawOptions))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&options); err != nil {
+			return newError(parseError, token.Position{Filename: "plugin options"}, "", "%w", err)
+		}
+	}
+	goOptions, err := json.Marshal(options.Go)
+	if err != nil {
+		return newError(parseError, token.Position{Filename: "plugin options"}, "", "%w", err)
+	}
+	goSettings := pluginGoOptions{}
+	if err := yaml.Unmarshal(goOptions, &goSettings); err != nil {
+		return newError(parseError, token.Position{Filename: "plugin options"}, "", "%w", err)
+	}
+	//The query files would not be found, leaving only the db file instrumented
+	if goSettings.OutputFilesSuffix != "" {
+		return newError(unsupportedError, token.Position{Filename: "plugin options"}, "", "output_files_suffix is not supported, only query files ending in .sql.go are instrumented")
+	}
+
+	//The Go plugin gets the request with its own options in place of the ones of this plugin. Every field of the
+	//request is length delimited, so none is lost by passing on only those.
+	var goRequest []byte
+	err = readProtoFields(request, func(field int, value []byte) error {
+		if field != 5 {
+			goRequest = appendProtoBytes(goRequest, field, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return newError(parseError, token.Position{Filename: "stdin"}, "", "invalid codegen request: %w", err)
+	}
+	goRequest = appendProtoBytes(goRequest, 5, goOptions)
+	var stderr bytes.Buffer
+	cmd := exec.Command(options.Plugin, pluginMethod)
+	cmd.Stdin = bytes.NewReader(goRequest)
+	cmd.Stderr = &stderr
+	response, err := cmd.Output()
+	if err != nil && stderr.Len() > 0 {
+		return newError(usageError, token.Position{}, "", "running %s: %w: %s", options.Plugin, err, strings.TrimSpace(stderr.String()))
+	} else if err != nil {
+		return newError(usageError, token.Position{}, "", "running %s: %w", options.Plugin, err)
+	}
+
+	//The files are instrumented in a temporary directory, the same way as the files of a package on disk
+	dir, err := os.MkdirTemp("", "sqlc-metrics-generator")
+	if err != nil {
+		return newError(ioError, token.Position{}, "", "%w", err)
+	}
+	defer os.RemoveAll(dir)
+	var names []string
+	contents := map[string][]byte{}
+	err = readProtoFields(response, func(field int, value []byte) error {
+		if field != 1 {
+			return nil
+		}
+		var name string
+		var content []byte
+		err := readProtoFields(value, func(field int, value []byte) error {
+			switch field {
+			case 1:
+				name = string(value)
+			case 2:
+				content = value
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if name != filepath.Base(name) {
+			return fmt.Errorf("file %q is not in the output directory", name)
+		}
+		names = append(names, name)
+		contents[name] = content
+		return os.WriteFile(filepath.Join(dir, name), content, 0o644)
+	})
+	if err != nil {
+		return newError(parseError, token.Position{}, "", "invalid response of %s: %w", options.Plugin, err)
+	}
+
+	p := sqlcPackage{
+		Path:                      dir,
+		Engine:                    engine,
+		SqlPackage:                goSettings.SqlPackage,
+		EmitPreparedQueries:       goSettings.EmitPreparedQueries,
+		EmitMethodsWithDbArgument: goSettings.EmitMethodsWithDbArgument,
+		OutputDbFileName:          goSettings.OutputDbFileName,
+		OutputBatchFileName:       goSettings.OutputBatchFileName,
+		OutputCopyfromFileName:    goSettings.OutputCopyfromFileName,
+	}
+	if p.Engine == "" {
+		p.Engine = "postgresql"
+	}
+	if p.OutputDbFileName == "" {
+		p.OutputDbFileName = "db.go"
+	}
+	if p.OutputBatchFileName == "" {
+		p.OutputBatchFileName = "batch.go"
+	}
+	if p.OutputCopyfromFileName == "" {
+		p.OutputCopyfromFileName = "copyfrom.go"
+	}
+	c := &config{Packages: map[string]packageSettings{".": options.Metrics}, dir: dir}
+	if err := c.validate("plugin options"); err != nil {
+		return err
+	}
+	metricsOptions := newPackageOptions(c, dir, settings{})
+	metricsOptions.sqlc = p
+	if !metricsOptions.anyMetricEnabled() {
+		return newError(usageError, token.Position{Filename: "plugin options"}, "", "at least one of the metrics or traces needs to be set to true, otherwise this tool does not make sense")
+	}
+	queryFilenames, err := findQueryFiles(dir)
+	if err != nil {
+		return newError(ioError, token.Position{}, "", "%w", err)
+	}
+	outputs, errs := processPackage(dir, queryFilenames, p.OutputDbFileName, p.OutputBatchFileName, p.OutputCopyfromFileName, metricsOptions, false, false)
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	for _, output := range outputs {
+		contents[filepath.Base(output.filename)] = output.output
+	}
+
+	var files []byte
+	for _, name := range names {
+		file := appendProtoBytes(nil, 1, []byte(name))
+		file = appendProtoBytes(file, 2, contents[name])
+		files = appendProtoBytes(files, 1, file)
+	}
+	if _, err := stdout.Write(files); err != nil {
+		return newError(ioError, token.Position{Filename: "stdout"}, "", "%w", err)
+	}
+	return nil
+}
+
+// Calls fn with the number and the value of every length delimited field of a protobuf message, the only ones the
+// plugin reads. Fields of other wire types are skipped.
+func readProtoFields(message []byte, fn func(field int, value []byte) error) error {
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return fmt.Errorf("invalid tag")
+		}
+		message = message[n:]
+		switch tag & 7 {
+		case 0:
+			_, n = binary.Uvarint(message)
+			if n <= 0 {
+				return fmt.Errorf("invalid varint of field %d", tag>>3)
+			}
+			message = message[n:]
+		case 1, 5:
+			size := 8
+			if tag&7 == 5 {
+				size = 4
+			}
+			if len(message) < size {
+				return fmt.Errorf("truncated field %d", tag>>3)
+			}
+			message = message[size:]
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return fmt.Errorf("truncated field %d", tag>>3)
+			}
+			if err := fn(int(tag>>3), message[n:n+int(length)]); err != nil {
+				return err
+			}
+			message = message[n+int(length):]
+		default:
+			return fmt.Errorf("unsupported wire type %d of field %d", tag&7, tag>>3)
+		}
+	}
+	return nil
+}
+
+// Appends a length delimited field to a protobuf message
+func appendProtoBytes(message []byte, field int, value []byte) []byte {
+	message = binary.AppendUvarint(message, uint64(field)<<3|2)
+	message = binary.AppendUvarint(message, uint64(len(value)))
+	return append(message, value...)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadProtoFields(t *testing.T) {
+	message := appendProtoBytes(nil, 1, []byte("settings"))
+	//A varint, a fixed64 and a fixed32 field, which are skipped
+	message = binary.AppendUvarint(message, 2<<3|0)
+	message = binary.AppendUvarint(message, 300)
+	message = binary.AppendUvarint(message, 3<<3|1)
+	message = append(message, make([]byte, 8)...)
+	message = binary.AppendUvarint(message, 4<<3|5)
+	message = append(message, make([]byte, 4)...)
+	message = appendProtoBytes(message, 5, []byte(`{"go":{}}`))
+	message = appendProtoBytes(message, 300, nil)
+
+	var fields []int
+	var values []string
+	err := readProtoFields(message, func(field int, value []byte) error {
+		fields = append(fields, field)
+		values = append(values, string(value))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(fields, []int{1, 5, 300}) || !slices.Equal(values, []string{"settings", `{"go":{}}`, ""}) {
+		t.Errorf("got fields %v with values %q", fields, values)
+	}
+
+	for _, truncated := range [][]byte{message[:len(message)-12], {1<<3 | 2, 5, 'a'}, {0x80}} {
+		if err := readProtoFields(truncated, func(int, []byte) error { return nil }); err == nil {
+			t.Errorf("no error for truncated message %v", truncated)
+		}
+	}
+}
+
+// Runs the test binary as a stub of the Go plugin if STUB_PLUGIN_FILES is set. The stub saves the request it gets to
+// STUB_PLUGIN_REQUEST and returns the files of the directory STUB_PLUGIN_FILES, or fails if it is set to fail.
+func TestMain(m *testing.M) {
+	if files := os.Getenv("STUB_PLUGIN_FILES"); files != "" {
+		os.Exit(runStubPlugin(files))
+	}
+	os.Exit(m.Run())
+}
+
+func runStubPlugin(files string) int {
+	if files == "fail" {
+		fmt.Fprintln(os.Stderr, "unknown option emit_everything")
+		return 1
+	}
+	request, err := io.ReadAll(os.Stdin)
+	if err == nil {
+		err = os.WriteFile(os.Getenv("STUB_PLUGIN_REQUEST"), request, 0o644)
+	}
+	entries, _ := os.ReadDir(files)
+	var response []byte
+	for _, entry := range entries {
+		content, readErr := os.ReadFile(filepath.Join(files, entry.Name()))
+		if readErr != nil {
+			err = readErr
+		}
+		file := appendProtoBytes(nil, 1, []byte(entry.Name()))
+		file = appendProtoBytes(file, 2, content)
+		response = appendProtoBytes(response, 1, file)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	os.Stdout.Write(response)
+	return 0
+}
+
+// Returns a codegen request with the given plugin options, every other field only needs to be passed on
+func pluginRequest(options string) []byte {
+	settings := appendProtoBytes(nil, 1, []byte("2"))
+	settings = appendProtoBytes(settings, 2, []byte("postgresql"))
+	request := appendProtoBytes(nil, 1, settings)
+	request = appendProtoBytes(request, 2, []byte("catalog"))
+	request = appendProtoBytes(request, 3, []byte("queries"))
+	request = appendProtoBytes(request, 4, []byte("v1.27.0"))
+	request = appendProtoBytes(request, 5, []byte(options))
+	return appendProtoBytes(request, 6, []byte(`{"global":true}`))
+}
+
+// Returns the fields of a protobuf message in order
+func protoFields(t *testing.T, message []byte) ([]int, [][]byte) {
+	t.Helper()
+	var fields []int
+	var values [][]byte
+	err := readProtoFields(message, func(field int, value []byte) error {
+		fields = append(fields, field)
+		values = append(values, value)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fields, values
+}
+
+func TestRunPlugin(t *testing.T) {
+	requestFilename := filepath.Join(t.TempDir(), "request")
+	t.Setenv("STUB_PLUGIN_FILES", filepath.Join("testdata", "pgx"))
+	t.Setenv("STUB_PLUGIN_REQUEST", requestFilename)
+	options := fmt.Sprintf(`{"plugin": %q, "go": {"package": "db", "sql_package": "pgx/v5"}, "metrics": {"errorMetrics": true}}`, os.Args[0])
+
+	var response bytes.Buffer
+	if err := runPlugin(bytes.NewReader(pluginRequest(options)), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	//The Go plugin gets every field of the request, with its own options in place of the ones of this plugin
+	request, err := os.ReadFile(requestFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, values := protoFields(t, request)
+	wantFields, wantValues := protoFields(t, pluginRequest(""))
+	if !slices.Equal(fields, []int{1, 2, 3, 4, 6, 5}) {
+		t.Fatalf("fields of the request of the Go plugin = %v, want every field with the options last", fields)
+	}
+	for i, field := range fields[:5] {
+		j := slices.Index(wantFields, field)
+		if !bytes.Equal(values[i], wantValues[j]) {
+			t.Errorf("field %d of the request of the Go plugin = %q, want %q", field, values[i], wantValues[j])
+		}
+	}
+	if string(values[5]) != `{"package":"db","sql_package":"pgx/v5"}` {
+		t.Errorf("options of the Go plugin = %s, want the go options", values[5])
+	}
+
+	//The files are returned in the order of the Go plugin, the ones sqlc generates instrumented
+	original := readFiles(t, filepath.Join("testdata", "pgx"))
+	fields, values = protoFields(t, response.Bytes())
+	var names []string
+	for i, field := range fields {
+		if field != 1 {
+			t.Fatalf("response has field %d", field)
+		}
+		_, file := protoFields(t, values[i])
+		name, content := string(file[0]), string(file[1])
+		names = append(names, name)
+		instrumented := strings.Contains(content, "// Modified by sqlc-metrics-generator")
+		if want := name != "models.go"; instrumented != want {
+			t.Errorf("%s is instrumented: %v, want %v", name, instrumented, want)
+		}
+		if name == "models.go" && content != original[name] {
+			t.Errorf("models.go is changed")
+		}
+	}
+	if wantNames := slices.Sorted(maps.Keys(original)); !slices.Equal(names, wantNames) {
+		t.Errorf("files of the response = %v, want %v", names, wantNames)
+	}
+}
+
+func TestRunPluginErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    string
+		options  string
+		wantKind errorKind
+		wantErr  string
+	}{
+		{"failing plugin", "fail", `{"metrics": {"errorMetrics": true}}`, usageError, "exit status 1: unknown option emit_everything"},
+		{"output_files_suffix", "testdata/pgx", `{"go": {"output_files_suffix": "_gen"}, "metrics": {"errorMetrics": true}}`, unsupportedError, "output_files_suffix is not supported"},
+		{"unknown option", "testdata/pgx", `{"metrics": {"errorMetric": true}}`, parseError, "field errorMetric not found"},
+		{"no metrics", "testdata/pgx", `{}`, usageError, "at least one of the metrics or traces"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("STUB_PLUGIN_FILES", test.files)
+			t.Setenv("STUB_PLUGIN_REQUEST", filepath.Join(t.TempDir(), "request"))
+			//The options are JSON, so the plugin is added as the first field
+			options := fmt.Sprintf(`{"plugin": %q, `, os.Args[0]) + strings.TrimPrefix(test.options, "{")
+			var response bytes.Buffer
+			err := runPlugin(bytes.NewReader(pluginRequest(options)), &response)
+			var generatorErr *generatorError
+			if !errors.As(err, &generatorErr) || generatorErr.Kind != test.wantKind || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("runPlugin() = %v, want %q (%v)", err, test.wantErr, test.wantKind)
+			}
+			if response.Len() > 0 {
+				t.Errorf("runPlugin() wrote a response after failing")
+			}
+		})
+	}
+}
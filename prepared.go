@@ -0,0 +1,306 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"text/template"
+)
+
+// The imports prepareStatement uses besides database/sql, which sqlc already imports for Prepare
+var prepareImports = []string{
+	"context",
+	"go.opentelemetry.io/otel/attribute",
+	"go.opentelemetry.io/otel/metric",
+	"time",
+}
+
+// The name of the statements prepared by Prepare in the metric names, taking the place of the query
+const prepareMetricName = "prepare"
+
+// The method Prepare calls instead of PrepareContext to record the preparation of a statement
+const prepareStatementFunction = "prepareStatement"
+
+// The variable Prepare stores the Queries created by New in, before it copies them into its own Queries
+const instrumentedQueries = "instrumented"
+
+// Returns the instruments of the statements prepared by Prepare
+func prepareInstruments() []packageInstrument {
+	return []packageInstrument{
+		{"prepareDurationHistogram", "Float64Histogram", []string{"duration", "histogram"}, "s", "Duration of preparing the statements of the queries"},
+		{"prepareErrorCounter", "Int64Counter", []string{"error", "counter"}, "{statement}", "Statements of the queries that failed to prepare"},
+	}
+}
+
+// Returns the Prepare function sqlc generates with emit_prepared_queries, or nil if the package has none
+func findPrepare(file *ast.File) *ast.FuncDecl {
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && FuncDecl.Recv == nil && FuncDecl.Name.Name == "Prepare" {
+			return FuncDecl
+		}
+	}
+	return nil
+}
+
+// Lets Prepare take the same arguments as New and create its Queries with New, so the prepared queries record on the
+// same instruments. Every statement is prepared by prepareStatement, which records the duration and the failures of
+// the preparation. The Queries sqlc creates is replaced by the one created by New, restorePrepare creates it again.
+func instrumentPrepare(fset *token.FileSet, file *ast.File, options *packageOptions) error {
+	Prepare := findPrepare(file)
+	var New *ast.FuncDecl
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && FuncDecl.Recv == nil && FuncDecl.Name.Name == "New" {
+			New = FuncDecl
+		}
+	}
+	if Prepare == nil || New == nil {
+		return nil
+	}
+	//sqlc begins Prepare with q := Queries{db: db} and var err error
+	body := Prepare.Body.List
+	if len(body) < 2 || !isQueriesLiteral(body[0]) || !isErrDeclaration(body[1]) {
+		return newError(unsupportedError, fset.Position(Prepare.Body.Pos()), "", "Prepare has to begin with q := Queries{db: db} and var err error")
+	}
+
+	//Prepare passes its connection and the new parameters on to New
+	var args []ast.Expr
+	for i, field := range New.Type.Params.List {
+		for _, name := range field.Names {
+			args = append(args, &ast.Ident{
+				Name: name.Name,
+			})
+		}
+		if i > 0 {
+			Prepare.Type.Params.List = append(Prepare.Type.Params.List, field)
+		}
+	}
+	//The parameters have no positions, a closing parenthesis behind them would make the printer break the line
+	Prepare.Type.Params.Closing = token.NoPos
+	//The Queries created by New replace the one sqlc creates, after err has been declared
+	instrument := []ast.Stmt{
+		body[1],
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{
+				&ast.Ident{
+					Name: instrumentedQueries,
+				},
+				&ast.Ident{
+					Name: "err",
+				},
+			},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{
+				&ast.CallExpr{
+					Fun: &ast.Ident{
+						Name: "New",
+					},
+					Args: args,
+				},
+			},
+		},
+		&ast.IfStmt{
+			Cond: &ast.BinaryExpr{
+				X: &ast.Ident{
+					Name: "err",
+				},
+				Op: token.NEQ,
+				Y: &ast.Ident{
+					Name: "nil",
+				},
+			},
+			Body: &ast.BlockStmt{
+				List: []ast.Stmt{
+					&ast.ReturnStmt{
+						Results: []ast.Expr{
+							&ast.Ident{
+								Name: "nil",
+							},
+							&ast.Ident{
+								Name: "err",
+							},
+						},
+					},
+				},
+			},
+		},
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{
+				&ast.Ident{
+					Name: "q",
+				},
+			},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{
+				&ast.StarExpr{
+					X: &ast.Ident{
+						Name: instrumentedQueries,
+					},
+				},
+			},
+		},
+	}
+	Prepare.Body.List = append(instrument, body[2:]...)
+	//The line of the removed statement would be printed as a blank line
+	clearPositions(Prepare.Body)
+
+	ast.Inspect(Prepare.Body, func(node ast.Node) bool {
+		CallExpr, ok := node.(*ast.CallExpr)
+		if !ok || len(CallExpr.Args) != 2 {
+			return true
+		}
+		SelectorExpr, ok := CallExpr.Fun.(*ast.SelectorExpr)
+		if !ok || SelectorExpr.Sel.Name != "PrepareContext" {
+			return true
+		}
+		query, ok := CallExpr.Args[1].(*ast.Ident)
+		if !ok {
+			return true
+		}
+		//The statement is recorded under the name the metrics of its query use
+		name := options.query(setExported(query.Name)).Name
+		CallExpr.Fun = &ast.SelectorExpr{
+			X: &ast.Ident{
+				NamePos: SelectorExpr.Pos(),
+				Name:    "q",
+			},
+			Sel: &ast.Ident{
+				NamePos: SelectorExpr.Sel.Pos(),
+				Name:    prepareStatementFunction,
+			},
+		}
+		CallExpr.Args = []ast.Expr{
+			CallExpr.Args[0],
+			SelectorExpr.X,
+			&ast.BasicLit{
+				ValuePos: query.Pos(),
+				Kind:     token.STRING,
+				Value:    strconv.Quote(name),
+			},
+			query,
+		}
+		return true
+	})
+	return nil
+}
+
+// Returns true if stmt is q := Queries{db: db}
+func isQueriesLiteral(stmt ast.Stmt) bool {
+	AssignStmt, ok := stmt.(*ast.AssignStmt)
+	if !ok || AssignStmt.Tok != token.DEFINE || len(AssignStmt.Lhs) != 1 || !isIdent(AssignStmt.Lhs[0], "q") || len(AssignStmt.Rhs) != 1 {
+		return false
+	}
+	CompositeLit, ok := AssignStmt.Rhs[0].(*ast.CompositeLit)
+	if !ok || !isIdent(CompositeLit.Type, "Queries") || len(CompositeLit.Elts) != 1 {
+		return false
+	}
+	KeyValueExpr, ok := CompositeLit.Elts[0].(*ast.KeyValueExpr)
+	return ok && isIdent(KeyValueExpr.Key, "db") && isIdent(KeyValueExpr.Value, "db")
+}
+
+// Returns true if stmt is var err error
+func isErrDeclaration(stmt ast.Stmt) bool {
+	DeclStmt, ok := stmt.(*ast.DeclStmt)
+	if !ok {
+		return false
+	}
+	GenDecl, ok := DeclStmt.Decl.(*ast.GenDecl)
+	if !ok || GenDecl.Tok != token.VAR || len(GenDecl.Specs) != 1 {
+		return false
+	}
+	ValueSpec, ok := GenDecl.Specs[0].(*ast.ValueSpec)
+	return ok && len(ValueSpec.Names) == 1 && ValueSpec.Names[0].Name == "err" && isIdent(ValueSpec.Type, "error") && len(ValueSpec.Values) == 0
+}
+
+// Restores the Prepare function generated by sqlc
+func restorePrepare(file *ast.File) {
+	Prepare := findPrepare(file)
+	if Prepare == nil {
+		return
+	}
+	if len(Prepare.Type.Params.List) > 2 {
+		Prepare.Type.Params.List = Prepare.Type.Params.List[:2]
+	}
+	body := Prepare.Body.List
+	if len(body) >= 4 && isErrDeclaration(body[0]) {
+		if AssignStmt, ok := body[1].(*ast.AssignStmt); ok && len(AssignStmt.Lhs) == 2 && isIdent(AssignStmt.Lhs[0], instrumentedQueries) {
+			queries := &ast.AssignStmt{
+				Lhs: []ast.Expr{
+					&ast.Ident{
+						Name: "q",
+					},
+				},
+				Tok: token.DEFINE,
+				Rhs: []ast.Expr{
+					&ast.CompositeLit{
+						Type: &ast.Ident{
+							Name: "Queries",
+						},
+						Elts: []ast.Expr{
+							&ast.KeyValueExpr{
+								Key: &ast.Ident{
+									Name: "db",
+								},
+								Value: &ast.Ident{
+									Name: "db",
+								},
+							},
+						},
+					},
+				},
+			}
+			Prepare.Body.List = append([]ast.Stmt{queries, body[0]}, body[4:]...)
+			//The lines of the removed statements would be printed as a blank line
+			clearPositions(Prepare.Body)
+		}
+	}
+	ast.Inspect(Prepare.Body, func(node ast.Node) bool {
+		CallExpr, ok := node.(*ast.CallExpr)
+		if !ok || len(CallExpr.Args) != 4 {
+			return true
+		}
+		SelectorExpr, ok := CallExpr.Fun.(*ast.SelectorExpr)
+		if !ok || SelectorExpr.Sel.Name != prepareStatementFunction {
+			return true
+		}
+		CallExpr.Fun = &ast.SelectorExpr{
+			X: CallExpr.Args[1],
+			Sel: &ast.Ident{
+				NamePos: SelectorExpr.Sel.Pos(),
+				Name:    "PrepareContext",
+			},
+		}
+		CallExpr.Args = []ast.Expr{CallExpr.Args[0], CallExpr.Args[3]}
+		return true
+	})
+}
+
+// Returns true if expr is an identifier with the given name
+func isIdent(expr ast.Expr, name string) bool {
+	Ident, ok := expr.(*ast.Ident)
+	return ok && Ident.Name == name
+}
+
+// The function preparing the statements of Prepare
+var prepareStatementTemplate = template.Must(template.New("prepareStatement").Parse(`package db
+
+func (q *Queries) prepareStatement(ctx context.Context, db DBTX, name string, query string) (stmt *sql.Stmt, err error) {
+	attributes := metric.WithAttributes(attribute.String("db.query.name", name){{range .}}, {{.}}{{end}})
+	startTime := time.Now()
+	defer func() {
+		q.prepareDurationHistogram.Record(ctx, time.Since(startTime).Seconds(), attributes)
+		if err != nil {
+			q.prepareErrorCounter.Add(ctx, 1, attributes, metric.WithAttributes(attribute.String("error.type", classifyQueryError(err))))
+		}
+	}()
+	return db.PrepareContext(ctx, query)
+}
+`))
+
+// Creates prepareStatement, which prepares a statement for Prepare and records its duration and failures
+func createPrepareStatementFunction(fset *token.FileSet, file *ast.File, options *packageOptions) (ast.Decl, error) {
+	decls, err := parseTemplateDecls(prepareStatementTemplate, packageAttributes(options))
+	if err != nil {
+		return nil, newError(unsupportedError, fset.Position(file.Package), "", "%w", err)
+	}
+	return decls[0], nil
+}
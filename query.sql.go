@@ -4,45 +4,124 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
-	"fmt"
 	"go/ast"
 	"go/token"
 	"io"
 	"strconv"
+	"strings"
 )
 
-func modifyQuerySqlFile(file *ast.File, generateInvocationMetrics, generateErrorMetrics, generateQueryRuntimeMetrics bool) (*ast.File, []string, error) {
+var querySqlFileImports = []string{
+	"context",
+	"go.opentelemetry.io/otel/attribute",
+	"go.opentelemetry.io/otel/codes",
+	"go.opentelemetry.io/otel/metric",
+	"go.opentelemetry.io/otel/trace",
+	"time",
+}
+
+func modifyQuerySqlFile(fset *token.FileSet, file *ast.File, options *packageOptions) (*ast.File, []string, error) {
 
+	if len(file.Comments) == 0 {
+		return nil, nil, newError(unsupportedError, fset.Position(file.Package), "", "file has no sqlc header comment")
+	}
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok {
+			if err := validateQueryFunction(fset, FuncDecl); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
 	if previouslyModified(file) {
-		panic("modifyQuerySqlFile: file has already been modified")
+		stripQuerySqlFile(file)
 	}
-	addModifiedComment(file)
+	addModifiedComment(file, options.describe())
 
-	requiredImports := []string{
-		"context",
-		"go.opentelemetry.io/otel/attribute",
-		"go.opentelemetry.io/otel/metric",
-		"time",
-	}
 	var foundFunctions []string
-	addMissingImports(file, requiredImports)
+	addMissingImports(file, querySqlFileImports)
+
+	addQuerySources(file, options)
 
 	var versions []ast.Decl
 	for i, decl := range file.Decls {
-		v, err := generateVersionConstants(decl)
+		v, err := generateVersionConstants(fset, decl)
 		if err != nil {
 			return nil, nil, err
 		}
 		if v != nil {
 			versions = append(versions, v)
 		}
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && options.query(FuncDecl.Name.Name).Excluded {
+			continue
+		}
 		foundFunctions = addFoundFunction(decl, foundFunctions)
-		renameAndWrap(file, &decl, i, generateInvocationMetrics, generateErrorMetrics, generateQueryRuntimeMetrics)
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok {
+			renameAndWrap(file, &decl, i, options.query(FuncDecl.Name.Name))
+		}
 	}
 	file.Decls = append(file.Decls, versions...)
+	//Only keep the imports the enabled metrics use
+	removeUnusedImports(file, querySqlFileImports)
 	return file, foundFunctions, nil
 }
 
+// Records the sql and the doc comment of every query in the file, keyed by the name of the query
+func addQuerySources(file *ast.File, options *packageOptions) {
+	if options.sources == nil {
+		options.sources = map[string]querySource{}
+	}
+	for _, decl := range file.Decls {
+		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.CONST {
+			for _, spec := range GenDecl.Specs {
+				ValueSpec := spec.(*ast.ValueSpec)
+				if len(ValueSpec.Values) == 0 {
+					continue
+				}
+				if BasicLit, ok := ValueSpec.Values[0].(*ast.BasicLit); ok && BasicLit.Kind == token.STRING {
+					source := options.sources[setExported(ValueSpec.Names[0].Name)]
+					source.SQL, _ = strconv.Unquote(BasicLit.Value)
+					options.sources[setExported(ValueSpec.Names[0].Name)] = source
+				}
+			}
+		}
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && FuncDecl.Doc != nil {
+			source := options.sources[FuncDecl.Name.Name]
+			source.Doc = strings.Join(strings.Fields(FuncDecl.Doc.Text()), " ")
+			options.sources[FuncDecl.Name.Name] = source
+		}
+	}
+}
+
+// Returns the kind of the query, e.g. :many, from the -- name: line sqlc puts at the start of its sql
+func queryKind(query string) string {
+	line, _, _ := strings.Cut(query, "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[0] != "--" || fields[1] != "name:" {
+		return ""
+	}
+	return fields[3]
+}
+
+// Returns an error if the function is not a query method the wrapper generated by renameAndWrap can handle
+func validateQueryFunction(fset *token.FileSet, FuncDecl *ast.FuncDecl) error {
+	name := FuncDecl.Name.Name
+	if FuncDecl.Recv == nil || len(FuncDecl.Recv.List) != 1 || len(FuncDecl.Recv.List[0].Names) != 1 || FuncDecl.Recv.List[0].Names[0].Name != "q" {
+		return newError(unsupportedError, fset.Position(FuncDecl.Pos()), name, "only methods with a q *Queries receiver are supported")
+	}
+	params := FuncDecl.Type.Params.List
+	if len(params) == 0 || len(params[0].Names) == 0 || params[0].Names[0].Name != "ctx" {
+		return newError(unsupportedError, fset.Position(FuncDecl.Pos()), name, "the first parameter has to be ctx context.Context")
+	}
+	if FuncDecl.Type.Results == nil || len(FuncDecl.Type.Results.List) == 0 {
+		return newError(unsupportedError, fset.Position(FuncDecl.Pos()), name, "queries without results are not supported")
+	}
+	results := FuncDecl.Type.Results.List
+	if Ident, ok := results[len(results)-1].Type.(*ast.Ident); !ok || Ident.Name != "error" {
+		return newError(unsupportedError, fset.Position(FuncDecl.Pos()), name, "the last result has to be an error")
+	}
+	return nil
+}
+
 func addFoundFunction(decl ast.Decl, foundFunctions []string) []string {
 	if FuncDecl, ok := decl.(*ast.FuncDecl); ok {
 		foundFunctions = append(foundFunctions, FuncDecl.Name.Name)
@@ -50,12 +129,127 @@ func addFoundFunction(decl ast.Decl, foundFunctions []string) []string {
 	return foundFunctions
 }
 
-func renameAndWrap(file *ast.File, decl *ast.Decl, i int, generateInvocationMetrics, generateErrorMetrics, generateQueryRuntimeMetrics bool) {
+func renameAndWrap(file *ast.File, decl *ast.Decl, i int, options queryOptions) {
 	if FuncDecl, ok := (*decl).(*ast.FuncDecl); ok {
 		name := FuncDecl.Name.Name
 		file.Decls[i].(*ast.FuncDecl).Name.Name = setUnexported(FuncDecl.Name.Name) + "Original"
 		var Stmt []ast.Stmt
-		if generateQueryRuntimeMetrics {
+		//The span context replaces ctx, so the metrics and the original query are recorded within the span
+		if options.Traces {
+			Stmt = append(Stmt, startSpan(name, options)...)
+		}
+		//The attributes from the context are extracted once and recorded with every metric of the call
+		if options.ContextAttributes && options.recordsMetrics() {
+			Stmt = append(Stmt, &ast.AssignStmt{
+				Lhs: []ast.Expr{
+					&ast.Ident{
+						Name: "contextAttributes",
+					},
+				},
+				Tok: token.DEFINE,
+				Rhs: []ast.Expr{
+					&ast.CallExpr{
+						Fun: &ast.SelectorExpr{
+							X: &ast.Ident{
+								Name: "metric",
+							},
+							Sel: &ast.Ident{
+								Name: "WithAttributes",
+							},
+						},
+						Args: []ast.Expr{
+							&ast.CallExpr{
+								Fun: &ast.SelectorExpr{
+									X: &ast.Ident{
+										Name: "q",
+									},
+									Sel: &ast.Ident{
+										Name: "attributeExtractor",
+									},
+								},
+								Args: []ast.Expr{
+									&ast.Ident{
+										Name: "ctx",
+									},
+									&ast.BasicLit{
+										Kind:  token.STRING,
+										Value: strconv.Quote(name),
+									},
+								},
+							},
+						},
+						Ellipsis: 1,
+					},
+				},
+			})
+		}
+		if options.TxHelper {
+			Stmt = append(Stmt, countTxQuery())
+		}
+		if options.RuntimeMetrics {
+			record := []ast.Stmt{
+				&ast.AssignStmt{
+					Lhs: []ast.Expr{
+						&ast.Ident{
+							Name: "runtime",
+						},
+					},
+					Tok: token.DEFINE,
+					Rhs: []ast.Expr{
+						&ast.CallExpr{
+							Fun: &ast.SelectorExpr{
+								X: &ast.CallExpr{
+									Fun: &ast.SelectorExpr{
+										X: &ast.Ident{
+											Name: "time",
+										},
+										Sel: &ast.Ident{
+											Name: "Since",
+										},
+									},
+									Args: []ast.Expr{
+										&ast.Ident{
+											Name: "startTime",
+										},
+									},
+								},
+								Sel: &ast.Ident{
+									Name: "Seconds",
+								},
+							},
+						},
+					},
+				},
+				recordRuntime(name, "RuntimeHistogram", options),
+			}
+			//The semantic conventions record failed operations on the same histogram, with the error.type attribute
+			if options.Semconv {
+				record[1] = &ast.IfStmt{
+					Cond: &ast.BinaryExpr{
+						X: &ast.Ident{
+							Name: "err",
+						},
+						Op: token.NEQ,
+						Y: &ast.Ident{
+							Name: "nil",
+						},
+					},
+					Body: &ast.BlockStmt{
+						List: []ast.Stmt{
+							recordRuntime(name, "RuntimeHistogram", options, withErrorType),
+						},
+					},
+					Else: &ast.BlockStmt{
+						List: []ast.Stmt{
+							record[1],
+						},
+					},
+				}
+			}
+			//The gauge is kept for dashboards built before the histogram
+			if options.RuntimeGauge {
+				record = append(record, recordRuntime(name, "RuntimeGauge", options))
+			}
 			Stmt = append(Stmt, &ast.BlockStmt{
 				List: []ast.Stmt{
 					&ast.AssignStmt{
@@ -85,83 +279,7 @@ func renameAndWrap(file *ast.File, decl *ast.Decl, i int, generateInvocationMetr
 									Params: &ast.FieldList{},
 								},
 								Body: &ast.BlockStmt{
-									List: []ast.Stmt{
-										&ast.ExprStmt{
-											X: &ast.CallExpr{
-												Fun: &ast.SelectorExpr{
-													X: &ast.SelectorExpr{
-														X: &ast.Ident{
-															Name: "q",
-														},
-														Sel: &ast.Ident{
-															Name: setUnexported(name) + "RuntimeGauge",
-														},
-													},
-													Sel: &ast.Ident{
-														Name: "Record",
-													},
-												},
-												Args: []ast.Expr{
-													&ast.Ident{
-														Name: "ctx",
-													},
-													&ast.CallExpr{
-														Fun: &ast.SelectorExpr{
-															X: &ast.CallExpr{
-																Fun: &ast.SelectorExpr{
-																	X: &ast.Ident{
-																		Name: "time",
-																	},
-																	Sel: &ast.Ident{
-																		Name: "Since",
-																	},
-																},
-																Args: []ast.Expr{
-																	&ast.Ident{
-																		Name: "startTime",
-																	},
-																},
-															},
-															Sel: &ast.Ident{
-																Name: "Seconds",
-															},
-														},
-													},
-													&ast.CallExpr{
-														Fun: &ast.SelectorExpr{
-															X: &ast.Ident{
-																Name: "metric",
-															},
-															Sel: &ast.Ident{
-																Name: "WithAttributes",
-															},
-														},
-														Args: []ast.Expr{
-															&ast.CallExpr{
-																Fun: &ast.SelectorExpr{
-																	X: &ast.Ident{
-																		Name: "attribute",
-																	},
-																	Sel: &ast.Ident{
-																		Name: "String",
-																	},
-																},
-																Args: []ast.Expr{
-																	&ast.BasicLit{
-																		Kind:  token.STRING,
-																		Value: "\"query_version\"",
-																	},
-																	&ast.Ident{
-																		Name: setUnexported(name) + "Version",
-																	},
-																},
-															},
-														},
-													},
-												},
-											},
-										},
-									},
+									List: record,
 								},
 							},
 						},
@@ -169,7 +287,115 @@ func renameAndWrap(file *ast.File, decl *ast.Decl, i int, generateInvocationMetr
 				},
 			})
 		}
-		if generateErrorMetrics {
+		//The counter is decremented in a defer, so failed and panicking calls are not counted once they return
+		if options.InFlightMetrics {
+			add := func(value string) *ast.CallExpr {
+				return &ast.CallExpr{
+					Fun: &ast.SelectorExpr{
+						X: &ast.SelectorExpr{
+							X: &ast.Ident{
+								Name: "q",
+							},
+							Sel: &ast.Ident{
+								Name: options.field(name, "InFlightCounter"),
+							},
+						},
+						Sel: &ast.Ident{
+							Name: "Add",
+						},
+					},
+					Args: append([]ast.Expr{
+						&ast.Ident{
+							Name: "ctx",
+						},
+						&ast.BasicLit{
+							Kind:  token.INT,
+							Value: value,
+						},
+					}, measurementOptions(metricAttributes(name, options), options)...),
+				}
+			}
+			Stmt = append(Stmt, &ast.BlockStmt{
+				List: []ast.Stmt{
+					&ast.ExprStmt{
+						X: add("1"),
+					},
+					&ast.DeferStmt{
+						Call: add("-1"),
+					},
+				},
+			})
+		}
+		if options.ErrorMetrics {
+			count := func(attributes ast.Expr) ast.Stmt {
+				return &ast.ExprStmt{
+					X: &ast.CallExpr{
+						Fun: &ast.SelectorExpr{
+							X: &ast.SelectorExpr{
+								X: &ast.Ident{
+									Name: "q",
+								},
+								Sel: &ast.Ident{
+									Name: options.field(name, "ErrorCounter"),
+								},
+							},
+							Sel: &ast.Ident{
+								Name: "Add",
+							},
+						},
+						Args: append([]ast.Expr{
+							&ast.Ident{
+								Name: "ctx",
+							},
+							&ast.BasicLit{
+								Kind:  token.INT,
+								Value: "1",
+							},
+						}, measurementOptions(attributes, options)...),
+					},
+				}
+			}
+			errorStmt := count(withErrorType(metricAttributes(name, options)))
+			//Queries that return no rows are not counted as failed
+			if options.ExcludeNoRows {
+				errorStmt = &ast.IfStmt{
+					Init: &ast.AssignStmt{
+						Lhs: []ast.Expr{
+							&ast.Ident{
+								Name: "errorType",
+							},
+						},
+						Tok: token.DEFINE,
+						Rhs: []ast.Expr{
+							&ast.CallExpr{
+								Fun: &ast.Ident{
+									Name: classifyErrorFunction,
+								},
+								Args: []ast.Expr{
+									&ast.Ident{
+										Name: "err",
+									},
+								},
+							},
+						},
+					},
+					Cond: &ast.BinaryExpr{
+						X: &ast.Ident{
+							Name: "errorType",
+						},
+						Op: token.NEQ,
+						Y: &ast.BasicLit{
+							Kind:  token.STRING,
+							Value: strconv.Quote(noRowsErrorType),
+						},
+					},
+					Body: &ast.BlockStmt{
+						List: []ast.Stmt{
+							count(withErrorTypeVariable(metricAttributes(name, options))),
+						},
+					},
+				}
+			}
 			Stmt = append(Stmt, &ast.BlockStmt{
 				List: []ast.Stmt{
 					&ast.DeferStmt{
@@ -192,63 +418,7 @@ func renameAndWrap(file *ast.File, decl *ast.Decl, i int, generateInvocationMetr
 											},
 											Body: &ast.BlockStmt{
 												List: []ast.Stmt{
-													&ast.ExprStmt{
-														X: &ast.CallExpr{
-															Fun: &ast.SelectorExpr{
-																X: &ast.SelectorExpr{
-																	X: &ast.Ident{
-																		Name: "q",
-																	},
-																	Sel: &ast.Ident{
-																		Name: setUnexported(name) + "ErrorCounter",
-																	},
-																},
-																Sel: &ast.Ident{
-																	Name: "Add",
-																},
-															},
-															Args: []ast.Expr{
-																&ast.Ident{
-																	Name: "ctx",
-																},
-																&ast.BasicLit{
-																	Kind:  token.INT,
-																	Value: "1",
-																},
-																&ast.CallExpr{
-																	Fun: &ast.SelectorExpr{
-																		X: &ast.Ident{
-																			Name: "metric",
-																		},
-																		Sel: &ast.Ident{
-																			Name: "WithAttributes",
-																		},
-																	},
-																	Args: []ast.Expr{
-																		&ast.CallExpr{
-																			Fun: &ast.SelectorExpr{
-																				X: &ast.Ident{
-																					Name: "attribute",
-																				},
-																				Sel: &ast.Ident{
-																					Name: "String",
-																				},
-																			},
-																			Args: []ast.Expr{
-																				&ast.BasicLit{
-																					Kind:  token.STRING,
-																					Value: "\"query_version\"",
-																				},
-																				&ast.Ident{
-																					Name: setUnexported(name) + "Version",
-																				},
-																			},
-																		},
-																	},
-																},
-															},
-														},
-													},
+													errorStmt,
 												},
 											},
 										},
@@ -260,7 +430,7 @@ func renameAndWrap(file *ast.File, decl *ast.Decl, i int, generateInvocationMetr
 				},
 			})
 		}
-		if generateInvocationMetrics {
+		if options.InvocationMetrics {
 			Stmt = append(Stmt, &ast.BlockStmt{
 				List: []ast.Stmt{
 					&ast.ExprStmt{
@@ -271,14 +441,14 @@ func renameAndWrap(file *ast.File, decl *ast.Decl, i int, generateInvocationMetr
 										Name: "q",
 									},
 									Sel: &ast.Ident{
-										Name: setUnexported(name) + "InvocationCounter",
+										Name: options.field(name, "InvocationCounter"),
 									},
 								},
 								Sel: &ast.Ident{
 									Name: "Add",
 								},
 							},
-							Args: []ast.Expr{
+							Args: append([]ast.Expr{
 								&ast.Ident{
 									Name: "ctx",
 								},
@@ -286,32 +456,44 @@ func renameAndWrap(file *ast.File, decl *ast.Decl, i int, generateInvocationMetr
 									Kind:  token.INT,
 									Value: "1",
 								},
-								&ast.CallExpr{
-									Fun: &ast.SelectorExpr{
-										X: &ast.Ident{
-											Name: "metric",
-										},
-										Sel: &ast.Ident{
-											Name: "WithAttributes",
-										},
-									},
-									Args: []ast.Expr{
-										&ast.CallExpr{
-											Fun: &ast.SelectorExpr{
+							}, measurementOptions(metricAttributes(name, options), options)...),
+						},
+					},
+				},
+			})
+		}
+		//The rows passed to a :copyfrom query are known before it runs, so they are recorded even if it fails
+		if options.inputRowMetrics() {
+			Stmt = append(Stmt, &ast.BlockStmt{
+				List: []ast.Stmt{
+					recordInputRows(name, FuncDecl.Type.Params.List[len(FuncDecl.Type.Params.List)-1], options),
+				},
+			})
+		}
+		if options.rowMetrics() {
+			Stmt = append(Stmt, &ast.BlockStmt{
+				List: []ast.Stmt{
+					&ast.DeferStmt{
+						Call: &ast.CallExpr{
+							Fun: &ast.FuncLit{
+								Type: &ast.FuncType{
+									Params: &ast.FieldList{},
+								},
+								Body: &ast.BlockStmt{
+									List: []ast.Stmt{
+										&ast.IfStmt{
+											Cond: &ast.BinaryExpr{
 												X: &ast.Ident{
-													Name: "attribute",
+													Name: "err",
 												},
-												Sel: &ast.Ident{
-													Name: "String",
+												Op: token.EQL,
+												Y: &ast.Ident{
+													Name: "nil",
 												},
 											},
-											Args: []ast.Expr{
-												&ast.BasicLit{
-													Kind:  token.STRING,
-													Value: "\"query_version\"",
-												},
-												&ast.Ident{
-													Name: setUnexported(name) + "Version",
+											Body: &ast.BlockStmt{
+												List: []ast.Stmt{
+													recordRows(name, FuncDecl.Type.Results.List[0], options),
 												},
 											},
 										},
@@ -398,28 +580,421 @@ func renameAndWrap(file *ast.File, decl *ast.Decl, i int, generateInvocationMetr
 	}
 }
 
+// Records the runtime of the query on the instrument in the Queries field with the given suffix
+func recordRuntime(name, suffix string, options queryOptions, decorators ...func(ast.Expr) ast.Expr) ast.Stmt {
+	attributes := metricAttributes(name, options)
+	for _, decorator := range decorators {
+		attributes = decorator(attributes)
+	}
+	return &ast.ExprStmt{
+		X: &ast.CallExpr{
+			Fun: &ast.SelectorExpr{
+				X: &ast.SelectorExpr{
+					X: &ast.Ident{
+						Name: "q",
+					},
+					Sel: &ast.Ident{
+						Name: options.field(name, suffix),
+					},
+				},
+				Sel: &ast.Ident{
+					Name: "Record",
+				},
+			},
+			Args: append([]ast.Expr{
+				&ast.Ident{
+					Name: "ctx",
+				},
+				&ast.Ident{
+					Name: "runtime",
+				},
+			}, measurementOptions(attributes, options)...),
+		},
+	}
+}
+
+// Records the number of rows the query returned or affected, read from its first result
+func recordRows(name string, result *ast.Field, options queryOptions) ast.Stmt {
+	resultName := "arg0"
+	if len(result.Names) > 0 {
+		resultName = result.Names[0].Name
+	}
+	record := func(rows ast.Expr) ast.Stmt {
+		return &ast.ExprStmt{
+			X: &ast.CallExpr{
+				Fun: &ast.SelectorExpr{
+					X: &ast.SelectorExpr{
+						X: &ast.Ident{
+							Name: "q",
+						},
+						Sel: &ast.Ident{
+							Name: options.field(name, "RowsHistogram"),
+						},
+					},
+					Sel: &ast.Ident{
+						Name: "Record",
+					},
+				},
+				Args: append([]ast.Expr{
+					&ast.Ident{
+						Name: "ctx",
+					},
+					rows,
+				}, measurementOptions(metricAttributes(name, options), options)...),
+			},
+		}
+	}
+	rowsAffected := &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X: &ast.Ident{
+				Name: resultName,
+			},
+			Sel: &ast.Ident{
+				Name: "RowsAffected",
+			},
+		},
+	}
+	switch options.Kind {
+	case ":many":
+		return record(&ast.CallExpr{
+			Fun: &ast.Ident{
+				Name: "int64",
+			},
+			Args: []ast.Expr{
+				&ast.CallExpr{
+					Fun: &ast.Ident{
+						Name: "len",
+					},
+					Args: []ast.Expr{
+						&ast.Ident{
+							Name: resultName,
+						},
+					},
+				},
+			},
+		})
+	case ":execrows", ":copyfrom":
+		return record(&ast.Ident{
+			Name: resultName,
+		})
+	}
+	//The sql.Result of database/sql may not know the affected rows, the pgconn.CommandTag of pgx always does
+	if SelectorExpr, ok := result.Type.(*ast.SelectorExpr); !ok || SelectorExpr.Sel.Name != "Result" {
+		return record(rowsAffected)
+	}
+	return &ast.IfStmt{
+		Init: &ast.AssignStmt{
+			Lhs: []ast.Expr{
+				&ast.Ident{
+					Name: "rows",
+				},
+				&ast.Ident{
+					Name: "rowsErr",
+				},
+			},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{
+				rowsAffected,
+			},
+		},
+		Cond: &ast.BinaryExpr{
+			X: &ast.Ident{
+				Name: "rowsErr",
+			},
+			Op: token.EQL,
+			Y: &ast.Ident{
+				Name: "nil",
+			},
+		},
+		Body: &ast.BlockStmt{
+			List: []ast.Stmt{
+				record(&ast.Ident{
+					Name: "rows",
+				}),
+			},
+		},
+	}
+}
+
+// Starts the span of the query and ends it in a defer, recording the error returned by the query
+func startSpan(name string, options queryOptions) []ast.Stmt {
+	//The semantic conventions name the span after the query summary
+	spanName := name
+	if options.Semconv && options.Summary != "" {
+		spanName = options.Summary
+	}
+	//Spans always carry the attributes of the semantic conventions, their name already identifies the query
+	options.Semconv = true
+	attributes := metricAttributes(name, options).(*ast.CallExpr).Args
+	return []ast.Stmt{
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{
+				&ast.Ident{
+					Name: "ctx",
+				},
+				&ast.Ident{
+					Name: "span",
+				},
+			},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{
+				&ast.CallExpr{
+					Fun: &ast.SelectorExpr{
+						X: &ast.SelectorExpr{
+							X: &ast.Ident{
+								Name: "q",
+							},
+							Sel: &ast.Ident{
+								Name: "tracer",
+							},
+						},
+						Sel: &ast.Ident{
+							Name: "Start",
+						},
+					},
+					Args: []ast.Expr{
+						&ast.Ident{
+							Name: "ctx",
+						},
+						&ast.BasicLit{
+							Kind:  token.STRING,
+							Value: strconv.Quote(spanName),
+						},
+						&ast.CallExpr{
+							Fun: &ast.SelectorExpr{
+								X: &ast.Ident{
+									Name: "trace",
+								},
+								Sel: &ast.Ident{
+									Name: "WithSpanKind",
+								},
+							},
+							Args: []ast.Expr{
+								&ast.SelectorExpr{
+									X: &ast.Ident{
+										Name: "trace",
+									},
+									Sel: &ast.Ident{
+										Name: "SpanKindClient",
+									},
+								},
+							},
+						},
+						&ast.CallExpr{
+							Fun: &ast.SelectorExpr{
+								X: &ast.Ident{
+									Name: "trace",
+								},
+								Sel: &ast.Ident{
+									Name: "WithAttributes",
+								},
+							},
+							Args: attributes,
+						},
+					},
+				},
+			},
+		},
+		&ast.DeferStmt{
+			Call: &ast.CallExpr{
+				Fun: &ast.FuncLit{
+					Type: &ast.FuncType{
+						Params: &ast.FieldList{},
+					},
+					Body: &ast.BlockStmt{
+						List: []ast.Stmt{
+							&ast.IfStmt{
+								Cond: &ast.BinaryExpr{
+									X: &ast.Ident{
+										Name: "err",
+									},
+									Op: token.NEQ,
+									Y: &ast.Ident{
+										Name: "nil",
+									},
+								},
+								Body: &ast.BlockStmt{
+									List: []ast.Stmt{
+										&ast.ExprStmt{
+											X: &ast.CallExpr{
+												Fun: &ast.SelectorExpr{
+													X: &ast.Ident{
+														Name: "span",
+													},
+													Sel: &ast.Ident{
+														Name: "RecordError",
+													},
+												},
+												Args: []ast.Expr{
+													&ast.Ident{
+														Name: "err",
+													},
+												},
+											},
+										},
+										&ast.ExprStmt{
+											X: &ast.CallExpr{
+												Fun: &ast.SelectorExpr{
+													X: &ast.Ident{
+														Name: "span",
+													},
+													Sel: &ast.Ident{
+														Name: "SetStatus",
+													},
+												},
+												Args: []ast.Expr{
+													&ast.SelectorExpr{
+														X: &ast.Ident{
+															Name: "codes",
+														},
+														Sel: &ast.Ident{
+															Name: "Error",
+														},
+													},
+													&ast.CallExpr{
+														Fun: &ast.SelectorExpr{
+															X: &ast.Ident{
+																Name: "err",
+															},
+															Sel: &ast.Ident{
+																Name: "Error",
+															},
+														},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+							&ast.ExprStmt{
+								X: &ast.CallExpr{
+									Fun: &ast.SelectorExpr{
+										X: &ast.Ident{
+											Name: "span",
+										},
+										Sel: &ast.Ident{
+											Name: "End",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Returns the options of a measurement with the given attributes. The attributes from the context come first, so the
+// generated ones take precedence if a key is used by both.
+func measurementOptions(attributes ast.Expr, options queryOptions) []ast.Expr {
+	if !options.ContextAttributes {
+		return []ast.Expr{attributes}
+	}
+	return []ast.Expr{
+		&ast.Ident{
+			Name: "contextAttributes",
+		},
+		attributes,
+	}
+}
+
+// Returns an attribute with a constant value
+func stringAttribute(key, value string) ast.Expr {
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X: &ast.Ident{
+				Name: "attribute",
+			},
+			Sel: &ast.Ident{
+				Name: "String",
+			},
+		},
+		Args: []ast.Expr{
+			&ast.BasicLit{
+				Kind:  token.STRING,
+				Value: strconv.Quote(key),
+			},
+			&ast.BasicLit{
+				Kind:  token.STRING,
+				Value: strconv.Quote(value),
+			},
+		},
+	}
+}
+
+// Returns the metric.WithAttributes option recorded with every metric of the query
+func metricAttributes(name string, options queryOptions) ast.Expr {
+	var attributes []ast.Expr
+	switch {
+	//The semantic conventions identify the query by its operation and table
+	case options.Semconv:
+		attributes = append(attributes, stringAttribute("db.system.name", options.DbSystem))
+		if options.Operation != "" {
+			attributes = append(attributes, stringAttribute("db.operation.name", options.Operation))
+		}
+		if options.Collection != "" {
+			attributes = append(attributes, stringAttribute("db.collection.name", options.Collection))
+		}
+		if options.Summary != "" {
+			attributes = append(attributes, stringAttribute("db.query.summary", options.Summary))
+		}
+	//Shared instruments tell the queries apart by their name
+	case options.SharedInstruments:
+		attributes = append(attributes, stringAttribute("db.query.name", options.Name))
+	}
+	attributes = append(attributes, &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X: &ast.Ident{
+				Name: "attribute",
+			},
+			Sel: &ast.Ident{
+				Name: "String",
+			},
+		},
+		Args: []ast.Expr{
+			&ast.BasicLit{
+				Kind:  token.STRING,
+				Value: "\"query_version\"",
+			},
+			&ast.Ident{
+				Name: setUnexported(name) + "Version",
+			},
+		},
+	})
+	for _, key := range sortedKeys(options.Attributes) {
+		attributes = append(attributes, stringAttribute(key, options.Attributes[key]))
+	}
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X: &ast.Ident{
+				Name: "metric",
+			},
+			Sel: &ast.Ident{
+				Name: "WithAttributes",
+			},
+		},
+		Args: attributes,
+	}
+}
+
 // Generates the version constants, which are build by SHA256-Hashing the sql-query
-func generateVersionConstants(decl ast.Decl) (ast.Decl, error) {
+func generateVersionConstants(fset *token.FileSet, decl ast.Decl) (ast.Decl, error) {
 	if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.CONST {
 		for _, spec := range GenDecl.Specs {
-			Sha256 := sha256.New()
-			_, err := Sha256.Write([]byte(spec.(*ast.ValueSpec).Values[0].(*ast.BasicLit).Value))
-			if err != nil {
-				fmt.Println(err)
-			}
-			encoded := bytes.NewBuffer([]byte{})
-			writer := base64.NewEncoder(base64.StdEncoding, encoded)
-			_, err = writer.Write(Sha256.Sum(nil))
-			if err != nil {
-				return nil, err
+			ValueSpec := spec.(*ast.ValueSpec)
+			if len(ValueSpec.Values) == 0 {
+				return nil, newError(unsupportedError, fset.Position(ValueSpec.Pos()), setExported(ValueSpec.Names[0].Name), "constant has no value")
 			}
-			err = writer.Close()
-			if err != nil {
-				return nil, err
+			BasicLit, ok := ValueSpec.Values[0].(*ast.BasicLit)
+			if !ok || BasicLit.Kind != token.STRING {
+				return nil, newError(unsupportedError, fset.Position(ValueSpec.Pos()), setExported(ValueSpec.Names[0].Name), "the query has to be a string literal")
 			}
-			all, err := io.ReadAll(encoded)
+			version, err := queryVersion(BasicLit.Value)
 			if err != nil {
-				return nil, err
+				return nil, newError(unsupportedError, fset.Position(ValueSpec.Pos()), setExported(ValueSpec.Names[0].Name), "version can not be computed: %w", err)
 			}
 			return &ast.GenDecl{
 				Tok: token.CONST,
@@ -433,7 +1008,7 @@ func generateVersionConstants(decl ast.Decl) (ast.Decl, error) {
 						Values: []ast.Expr{
 							&ast.BasicLit{
 								Kind:  token.STRING,
-								Value: "\"" + string(all) + "\"",
+								Value: "\"" + version + "\"",
 							},
 						},
 					},
@@ -444,3 +1019,72 @@ func generateVersionConstants(decl ast.Decl) (ast.Decl, error) {
 	}
 	return nil, nil
 }
+
+// Returns the base64 encoded SHA256 hash of the sql-query literal
+func queryVersion(query string) (string, error) {
+	Sha256 := sha256.New()
+	_, err := Sha256.Write([]byte(query))
+	if err != nil {
+		return "", err
+	}
+	encoded := bytes.NewBuffer([]byte{})
+	writer := base64.NewEncoder(base64.StdEncoding, encoded)
+	_, err = writer.Write(Sha256.Sum(nil))
+	if err != nil {
+		return "", err
+	}
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+	all, err := io.ReadAll(encoded)
+	if err != nil {
+		return "", err
+	}
+	return string(all), nil
+}
+
+// Removes everything modifyQuerySqlFile added, leaving the file as sqlc generated it
+func stripQuerySqlFile(file *ast.File) {
+	removeModifiedComment(file)
+
+	originals := map[string]bool{}
+	constants := map[string]bool{}
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && FuncDecl.Recv != nil && strings.HasSuffix(FuncDecl.Name.Name, "Original") {
+			originals[FuncDecl.Name.Name] = true
+		}
+		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.CONST {
+			for _, spec := range GenDecl.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					constants[name.Name] = true
+				}
+			}
+		}
+	}
+
+	//Remove the wrappers and restore the original names
+	removeFunctions(file, func(FuncDecl *ast.FuncDecl) bool {
+		return FuncDecl.Recv != nil && originals[setUnexported(FuncDecl.Name.Name)+"Original"]
+	})
+	for _, decl := range file.Decls {
+		if FuncDecl, ok := decl.(*ast.FuncDecl); ok && originals[FuncDecl.Name.Name] {
+			FuncDecl.Name.Name = setExported(strings.TrimSuffix(FuncDecl.Name.Name, "Original"))
+		}
+	}
+
+	//Remove the version constants
+	var decls []ast.Decl
+	for _, decl := range file.Decls {
+		if GenDecl, ok := decl.(*ast.GenDecl); ok && GenDecl.Tok == token.CONST && len(GenDecl.Specs) == 1 {
+			name := GenDecl.Specs[0].(*ast.ValueSpec).Names[0].Name
+			if strings.HasSuffix(name, "Version") && constants[strings.TrimSuffix(name, "Version")] {
+				continue
+			}
+		}
+		decls = append(decls, decl)
+	}
+	file.Decls = decls
+
+	removeUnusedImports(file, querySqlFileImports)
+}
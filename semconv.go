@@ -0,0 +1,147 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// The bucket boundaries of db.client.operation.duration recommended by the OpenTelemetry database semantic conventions
+var semconvRuntimeBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+// The name of the duration histogram defined by the OpenTelemetry database semantic conventions
+const semconvDurationMetric = "db.client.operation.duration"
+
+// Returns the operation, e.g. SELECT, and the tables the sql query operates on, in the order they appear. Only the
+// tables of the statement itself are returned, not the ones of sub queries.
+func parseQuery(query string) (operation string, tables []string) {
+	words := splitQuery(query)
+
+	//The keywords after which a table follows, besides UPDATE and COPY, which are followed by the table themselves
+	tableKeywords := map[string]bool{"FROM": true, "JOIN": true, "INTO": true, "USING": true}
+	operations := map[string]bool{"SELECT": true, "DELETE": true, "INSERT": true, "REPLACE": true, "UPDATE": true, "MERGE": true, "COPY": true}
+	//The keywords ending the list of tables of a FROM clause
+	clauseKeywords := map[string]bool{"WHERE": true, "GROUP": true, "HAVING": true, "ORDER": true, "LIMIT": true, "OFFSET": true, "WINDOW": true, "UNION": true, "INTERSECT": true, "EXCEPT": true, "FOR": true, "SET": true, "RETURNING": true, "ON": true}
+	start := -1
+	for i, word := range words {
+		if operations[strings.ToUpper(word)] {
+			operation, start = strings.ToUpper(word), i
+			break
+		}
+	}
+	if start < 0 {
+		if len(words) > 0 {
+			operation = strings.ToUpper(words[0])
+		}
+		return operation, nil
+	}
+
+	expectTable := operation == "UPDATE" || operation == "COPY"
+	fromList := false
+	for _, word := range words[start+1:] {
+		keyword := strings.ToUpper(word)
+		switch {
+		case expectTable:
+			//ONLY and LATERAL precede the table, a parenthesis a sub query or a column list
+			if keyword == "ONLY" || keyword == "LATERAL" {
+				continue
+			}
+			expectTable = false
+			if word != "(" && !slices.Contains(tables, word) {
+				tables = append(tables, word)
+			}
+			//The FROM of COPY names a file, not a table
+			if operation == "COPY" {
+				return operation, tables
+			}
+		case tableKeywords[keyword]:
+			expectTable = true
+			fromList = keyword == "FROM"
+		case word == ",":
+			expectTable = fromList
+		case clauseKeywords[keyword]:
+			fromList = false
+		}
+	}
+	return operation, tables
+}
+
+// Splits the sql query into the words of the statement itself, leaving out comments, string literals and everything
+// within parentheses, which is replaced by a single "(". Commas are returned as words of their own, quoted
+// identifiers without their quotes.
+func splitQuery(query string) []string {
+	var words []string
+	var word strings.Builder
+	depth := 0
+	flush := func() {
+		if depth == 0 && word.Len() > 0 {
+			words = append(words, word.String())
+		}
+		word.Reset()
+	}
+	runes := []rune(query)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		switch {
+		case r == '-' && next == '-':
+			flush()
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && next == '*':
+			flush()
+			for i += 2; i < len(runes) && !(runes[i-1] == '*' && runes[i] == '/'); i++ {
+			}
+		//A quote within a string literal or a quoted identifier is escaped by doubling it
+		case r == '\'':
+			flush()
+			for i++; i < len(runes); i++ {
+				if runes[i] == r && (i+1 == len(runes) || runes[i+1] != r) {
+					break
+				}
+				if runes[i] == r {
+					i++
+				}
+			}
+		case r == '"' || r == '`':
+			for i++; i < len(runes); i++ {
+				if runes[i] == r && (i+1 == len(runes) || runes[i+1] != r) {
+					break
+				}
+				if runes[i] == r {
+					i++
+				}
+				word.WriteRune(runes[i])
+			}
+		case r == '(':
+			flush()
+			if depth == 0 {
+				words = append(words, "(")
+			}
+			depth++
+		case r == ')':
+			flush()
+			depth = max(depth-1, 0)
+		case r == ',':
+			flush()
+			if depth == 0 {
+				words = append(words, ",")
+			}
+		case unicode.IsSpace(r), r == ';':
+			flush()
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return words
+}
+
+// Returns the value of db.query.summary, the operation followed by the tables if known
+func querySummary(operation string, tables []string) string {
+	return strings.TrimSpace(operation + " " + strings.Join(tables, " "))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		wantOperation string
+		wantTables    []string
+	}{
+		{"select", "-- name: GetAuthor :one\nSELECT id, name FROM authors WHERE id = $1 LIMIT 1", "SELECT", []string{"authors"}},
+		{"lower case", "select * from authors;", "SELECT", []string{"authors"}},
+		{"join", "SELECT a.name, b.title FROM authors a JOIN books b ON b.author_id = a.id", "SELECT", []string{"authors", "books"}},
+		{"same table twice", "SELECT * FROM authors a LEFT JOIN authors b ON b.id = a.parent_id", "SELECT", []string{"authors"}},
+		{"comma list", "SELECT * FROM authors AS a, books b WHERE b.author_id = a.id", "SELECT", []string{"authors", "books"}},
+		{"sub query", "SELECT * FROM (SELECT * FROM books) b, authors WHERE id IN (SELECT author_id FROM orders)", "SELECT", []string{"authors"}},
+		{"string literal", "SELECT * FROM authors WHERE name = '-- (not a comment' AND bio <> 'it''s' ORDER BY id", "SELECT", []string{"authors"}},
+		{"block comment", "SELECT /* FROM books */ * FROM authors", "SELECT", []string{"authors"}},
+		{"quoted identifier", `SELECT * FROM "public"."Authors" JOIN ` + "`books`" + ` USING (id)`, "SELECT", []string{"public.Authors", "books"}},
+		{"schema", "DELETE FROM public.authors WHERE id = $1", "DELETE", []string{"public.authors"}},
+		{"insert select", "INSERT INTO authors (name, bio) SELECT name, bio FROM imports RETURNING id", "INSERT", []string{"authors", "imports"}},
+		{"upsert", "INSERT INTO authors (id) VALUES ($1) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name", "INSERT", []string{"authors"}},
+		{"update from", "UPDATE ONLY authors SET name = n.name FROM names n WHERE n.id = authors.id", "UPDATE", []string{"authors", "names"}},
+		{"delete using", "DELETE FROM orders USING authors WHERE orders.author_id = authors.id", "DELETE", []string{"orders", "authors"}},
+		{"copy", "COPY authors (id, name) FROM STDIN", "COPY", []string{"authors"}},
+		{"common table expression", "WITH recent AS (SELECT * FROM orders) SELECT * FROM recent", "SELECT", []string{"recent"}},
+		{"no table", "SELECT now()", "SELECT", nil},
+		{"other statement", "truncate authors", "TRUNCATE", nil},
+		{"empty", "-- name: Nothing :exec\n", "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			operation, tables := parseQuery(test.query)
+			if operation != test.wantOperation || !slices.Equal(tables, test.wantTables) {
+				t.Errorf("parseQuery() = %q, %q, want %q, %q", operation, tables, test.wantOperation, test.wantTables)
+			}
+		})
+	}
+}
+
+func TestQuerySummary(t *testing.T) {
+	tests := []struct {
+		operation string
+		tables    []string
+		want      string
+	}{
+		{"SELECT", []string{"authors"}, "SELECT authors"},
+		{"SELECT", []string{"authors", "books"}, "SELECT authors books"},
+		{"SELECT", nil, "SELECT"},
+		{"", nil, ""},
+	}
+	for _, test := range tests {
+		if got := querySummary(test.operation, test.tables); got != test.want {
+			t.Errorf("querySummary(%q, %q) = %q, want %q", test.operation, test.tables, got, test.want)
+		}
+	}
+}
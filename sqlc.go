@@ -0,0 +1,219 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The settings of a Go package generated by sqlc that affect the instrumentation
+type sqlcPackage struct {
+	// The sqlc config the settings were read from, empty if there is none
+	Config string
+	// The output directory of the package
+	Path   string
+	Engine string
+	// Checked against the db file by validateSqlcPackage
+	SqlPackage                string
+	EmitPreparedQueries       bool
+	EmitMethodsWithDbArgument bool
+	// The name of the db file, db.go by default
+	OutputDbFileName string
+	// The name of the file of the batch queries, batch.go by default
+	OutputBatchFileName string
+	// The name of the file of the copyfrom queries, copyfrom.go by default
+	OutputCopyfromFileName string
+	// Rejected by validateSqlcPackage, since the query files are found by their .sql.go suffix
+	OutputFilesSuffix string
+}
+
+// The parts of the sqlc config file the generator needs, covering version 1 and version 2
+type sqlcConfig struct {
+	Version string `yaml:"version"`
+	// Version 1
+	Packages []struct {
+		Path                      string `yaml:"path"`
+		Engine                    string `yaml:"engine"`
+		SqlPackage                string `yaml:"sql_package"`
+		EmitPreparedQueries       bool   `yaml:"emit_prepared_queries"`
+		EmitMethodsWithDbArgument bool   `yaml:"emit_methods_with_db_argument"`
+		OutputDbFileName          string `yaml:"output_db_file_name"`
+		OutputBatchFileName       string `yaml:"output_batch_file_name"`
+		OutputCopyfromFileName    string `yaml:"output_copyfrom_file_name"`
+		OutputFilesSuffix         string `yaml:"output_files_suffix"`
+	} `yaml:"packages"`
+	// Version 2
+	Sql []struct {
+		Engine string `yaml:"engine"`
+		Gen    struct {
+			Go *struct {
+				Out                       string `yaml:"out"`
+				SqlPackage                string `yaml:"sql_package"`
+				EmitPreparedQueries       bool   `yaml:"emit_prepared_queries"`
+				EmitMethodsWithDbArgument bool   `yaml:"emit_methods_with_db_argument"`
+				OutputDbFileName          string `yaml:"output_db_file_name"`
+				OutputBatchFileName       string `yaml:"output_batch_file_name"`
+				OutputCopyfromFileName    string `yaml:"output_copyfrom_file_name"`
+				OutputFilesSuffix         string `yaml:"output_files_suffix"`
+			} `yaml:"go"`
+		} `yaml:"gen"`
+	} `yaml:"sql"`
+}
+
+// Reads the sqlc config file and returns every Go package it generates. The paths are resolved relative to the
+// directory of the config file.
+func loadSqlcConfig(filename string) ([]sqlcPackage, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fileError(filename, err)
+	}
+	c := sqlcConfig{}
+	if err := yaml.Unmarshal(content, &c); err != nil {
+		return nil, newError(parseError, token.Position{Filename: filename}, "", "%w", err)
+	}
+
+	dir := filepath.Dir(filename)
+	var packages []sqlcPackage
+	switch strings.TrimSpace(c.Version) {
+	case "1":
+		for _, p := range c.Packages {
+			packages = append(packages, sqlcPackage{
+				Path:                      filepath.Join(dir, p.Path),
+				Engine:                    p.Engine,
+				SqlPackage:                p.SqlPackage,
+				EmitPreparedQueries:       p.EmitPreparedQueries,
+				EmitMethodsWithDbArgument: p.EmitMethodsWithDbArgument,
+				OutputDbFileName:          p.OutputDbFileName,
+				OutputBatchFileName:       p.OutputBatchFileName,
+				OutputCopyfromFileName:    p.OutputCopyfromFileName,
+				OutputFilesSuffix:         p.OutputFilesSuffix,
+			})
+		}
+	case "2":
+		for _, s := range c.Sql {
+			if s.Gen.Go == nil {
+				continue
+			}
+			packages = append(packages, sqlcPackage{
+				Path:                      filepath.Join(dir, s.Gen.Go.Out),
+				Engine:                    s.Engine,
+				SqlPackage:                s.Gen.Go.SqlPackage,
+				EmitPreparedQueries:       s.Gen.Go.EmitPreparedQueries,
+				EmitMethodsWithDbArgument: s.Gen.Go.EmitMethodsWithDbArgument,
+				OutputDbFileName:          s.Gen.Go.OutputDbFileName,
+				OutputBatchFileName:       s.Gen.Go.OutputBatchFileName,
+				OutputCopyfromFileName:    s.Gen.Go.OutputCopyfromFileName,
+				OutputFilesSuffix:         s.Gen.Go.OutputFilesSuffix,
+			})
+		}
+	default:
+		return nil, newError(unsupportedError, token.Position{Filename: filename}, "", "unsupported sqlc config version %q", c.Version)
+	}
+	for i := range packages {
+		packages[i].Config = filename
+		if packages[i].Engine == "" {
+			packages[i].Engine = "postgresql"
+		}
+		if packages[i].OutputDbFileName == "" {
+			packages[i].OutputDbFileName = "db.go"
+		}
+		if packages[i].OutputBatchFileName == "" {
+			packages[i].OutputBatchFileName = "batch.go"
+		}
+		if packages[i].OutputCopyfromFileName == "" {
+			packages[i].OutputCopyfromFileName = "copyfrom.go"
+		}
+	}
+	if len(packages) == 0 {
+		return nil, newError(usageError, token.Position{Filename: filename}, "", "the sqlc config does not generate any Go package")
+	}
+	return packages, nil
+}
+
+// Returns the closest sqlc config in path or one of its parents
+func findSqlcConfig(path string) string {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	for {
+		for _, sqlcConfigFilename := range sqlcConfigFilenames {
+			if _, err := os.Stat(filepath.Join(dir, sqlcConfigFilename)); err == nil {
+				return filepath.Join(dir, sqlcConfigFilename)
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Returns the settings of the package in path from the closest sqlc config. If there is no sqlc config generating the
+// package, the defaults are returned.
+func findSqlcPackage(path string) sqlcPackage {
+	if filename := findSqlcConfig(path); filename != "" {
+		packages, err := loadSqlcConfig(filename)
+		dir, absErr := filepath.Abs(path)
+		if err == nil && absErr == nil {
+			for _, p := range packages {
+				if p.Path == dir {
+					return p
+				}
+			}
+		}
+	}
+	return sqlcPackage{Path: path, Engine: "postgresql", OutputDbFileName: "db.go", OutputBatchFileName: "batch.go", OutputCopyfromFileName: "copyfrom.go"}
+}
+
+// Checks the sql_package and emit_prepared_queries settings of the sqlc config against the db file. Code that does not
+// match them was generated with a different config, and instrumenting it would only fail later when it is compiled.
+func validateSqlcPackage(fset *token.FileSet, file *ast.File, p sqlcPackage) error {
+	if p.Config == "" {
+		return nil
+	}
+	//The query files would not be found, leaving only the db file instrumented
+	if p.OutputFilesSuffix != "" {
+		return newError(unsupportedError, fset.Position(file.Package), "", "output_files_suffix is set in %s, but only query files ending in .sql.go are instrumented", p.Config)
+	}
+	if Prepare := findPrepare(file); Prepare != nil && !p.EmitPreparedQueries {
+		return newError(usageError, fset.Position(Prepare.Pos()), "", "the db file has a Prepare function, but emit_prepared_queries is not set in %s", p.Config)
+	} else if Prepare == nil && p.EmitPreparedQueries {
+		return newError(usageError, fset.Position(file.Package), "", "emit_prepared_queries is set in %s, but the db file has no Prepare function", p.Config)
+	}
+
+	//The DBTX interface of database/sql has ExecContext, the one of pgx Exec
+	for _, decl := range file.Decls {
+		GenDecl, ok := decl.(*ast.GenDecl)
+		if !ok || GenDecl.Tok != token.TYPE {
+			continue
+		}
+		TypeSpec, ok := GenDecl.Specs[0].(*ast.TypeSpec)
+		if !ok || TypeSpec.Name.Name != "DBTX" {
+			continue
+		}
+		InterfaceType, ok := TypeSpec.Type.(*ast.InterfaceType)
+		if !ok {
+			continue
+		}
+		pgx := false
+		for _, method := range InterfaceType.Methods.List {
+			for _, name := range method.Names {
+				pgx = pgx || name.Name == "Exec"
+			}
+		}
+		if expected := strings.HasPrefix(p.SqlPackage, "pgx/"); pgx != expected {
+			sqlPackage := p.SqlPackage
+			if sqlPackage == "" {
+				sqlPackage = "database/sql"
+			}
+			return newError(usageError, fset.Position(TypeSpec.Pos()), "", "sql_package is %s in %s, but DBTX does not match it", sqlPackage, p.Config)
+		}
+	}
+	return nil
+}
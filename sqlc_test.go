@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadSqlcConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		want     []sqlcPackage
+	}{
+		{
+			"version 1",
+			"sqlc.yaml",
+			`version: "1"
+packages:
+  - name: db
+    path: internal/db
+    engine: mysql
+    emit_prepared_queries: true
+    output_db_file_name: dbtx.go
+`,
+			[]sqlcPackage{{Path: "internal/db", Engine: "mysql", EmitPreparedQueries: true, OutputDbFileName: "dbtx.go", OutputBatchFileName: "batch.go", OutputCopyfromFileName: "copyfrom.go"}},
+		},
+		{
+			"version 2",
+			"sqlc.yml",
+			`version: "2"
+sql:
+  - engine: postgresql
+    gen:
+      go:
+        out: ../db
+        sql_package: pgx/v5
+        emit_methods_with_db_argument: true
+        output_batch_file_name: batches.go
+        output_copyfrom_file_name: copies.go
+        output_files_suffix: _gen
+  - engine: sqlite
+    codegen:
+      - plugin: py
+        out: py
+  - gen:
+      go:
+        out: other
+`,
+			[]sqlcPackage{
+				{Path: "../db", Engine: "postgresql", SqlPackage: "pgx/v5", EmitMethodsWithDbArgument: true, OutputDbFileName: "db.go", OutputBatchFileName: "batches.go", OutputCopyfromFileName: "copies.go", OutputFilesSuffix: "_gen"},
+				{Path: "other", Engine: "postgresql", OutputDbFileName: "db.go", OutputBatchFileName: "batch.go", OutputCopyfromFileName: "copyfrom.go"},
+			},
+		},
+		{
+			"json",
+			"sqlc.json",
+			`{"version": "2", "sql": [{"engine": "postgresql", "gen": {"go": {"out": "db", "output_db_file_name": "conn.go"}}}]}`,
+			[]sqlcPackage{{Path: "db", Engine: "postgresql", OutputDbFileName: "conn.go", OutputBatchFileName: "batch.go", OutputCopyfromFileName: "copyfrom.go"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "config")
+			if err := os.Mkdir(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			filename := filepath.Join(dir, test.filename)
+			if err := os.WriteFile(filename, []byte(test.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			//The paths are relative to the directory of the config
+			for i := range test.want {
+				test.want[i].Config = filename
+				test.want[i].Path = filepath.Join(dir, test.want[i].Path)
+			}
+			got, err := loadSqlcConfig(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("loadSqlcConfig() = %+v, want %+v", got, test.want)
+			}
+			if found := findSqlcConfig(filepath.Join(dir, "sub", "dir")); found != filename {
+				t.Errorf("findSqlcConfig() = %q, want %q", found, filename)
+			}
+		})
+	}
+}
+
+func TestLoadSqlcConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantKind errorKind
+		wantErr  string
+	}{
+		{"invalid yaml", "version: [", parseError, "yaml"},
+		{"unsupported version", `version: "3"`, unsupportedError, `unsupported sqlc config version "3"`},
+		{"no Go package", "version: \"2\"\nsql:\n  - engine: postgresql\n", usageError, "does not generate any Go package"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "sqlc.yaml")
+			if err := os.WriteFile(filename, []byte(test.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadSqlcConfig(filename)
+			var generatorErr *generatorError
+			if !errors.As(err, &generatorErr) || generatorErr.Kind != test.wantKind || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("loadSqlcConfig() = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSqlcPackage(t *testing.T) {
+	const pgxDBTX = `
+type DBTX interface {
+	Exec(context.Context, string, ...interface{}) (pgconn.CommandTag, error)
+	Query(context.Context, string, ...interface{}) (pgx.Rows, error)
+	QueryRow(context.Context, string, ...interface{}) pgx.Row
+}
+`
+	const sqlDBTX = `
+type DBTX interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	PrepareContext(context.Context, string) (*sql.Stmt, error)
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+`
+	const prepare = `
+func Prepare(ctx context.Context, db DBTX) (*Queries, error) {
+	q := Queries{db: db}
+	var err error
+	return &q, err
+}
+`
+	tests := []struct {
+		name    string
+		source  string
+		p       sqlcPackage
+		wantErr string
+	}{
+		{"pgx", pgxDBTX, sqlcPackage{Config: "sqlc.yaml", SqlPackage: "pgx/v5"}, ""},
+		{"database/sql", sqlDBTX, sqlcPackage{Config: "sqlc.yaml"}, ""},
+		{"prepared", sqlDBTX + prepare, sqlcPackage{Config: "sqlc.yaml", EmitPreparedQueries: true}, ""},
+		{"no sqlc config", pgxDBTX + prepare, sqlcPackage{}, ""},
+		{"pgx expected", sqlDBTX, sqlcPackage{Config: "sqlc.yaml", SqlPackage: "pgx/v4"}, "sql_package is pgx/v4 in sqlc.yaml, but DBTX does not match it"},
+		{"database/sql expected", pgxDBTX, sqlcPackage{Config: "sqlc.yaml"}, "sql_package is database/sql in sqlc.yaml, but DBTX does not match it"},
+		{"unexpected Prepare", sqlDBTX + prepare, sqlcPackage{Config: "sqlc.yaml"}, "emit_prepared_queries is not set in sqlc.yaml"},
+		{"missing Prepare", sqlDBTX, sqlcPackage{Config: "sqlc.yaml", EmitPreparedQueries: true}, "emit_prepared_queries is set in sqlc.yaml, but the db file has no Prepare function"},
+		{"output_files_suffix", pgxDBTX, sqlcPackage{Config: "sqlc.yaml", SqlPackage: "pgx/v5", OutputFilesSuffix: "_gen"}, "output_files_suffix is set in sqlc.yaml"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "db.go", "package db\n"+test.source, parser.ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = validateSqlcPackage(fset, file, test.p)
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Errorf("validateSqlcPackage() = %v, want no error", err)
+			case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+				t.Errorf("validateSqlcPackage() = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// The wrappers keep the method set of Queries, so the Querier interface sqlc generates with emit_interface is still
+// implemented
+func TestEmitInterface(t *testing.T) {
+	dir := t.TempDir()
+	copyFixtures(t, dir, "pgx", "module", "querier")
+	enabled := true
+	runPackage(t, dir, settings{
+		InvocationMetrics: &enabled,
+		ErrorMetrics:      &enabled,
+		RuntimeMetrics:    &enabled,
+		Traces:            &enabled,
+	}, false)
+	runGo(t, dir, "vet", ".")
+}
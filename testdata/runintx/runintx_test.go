@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// Records the counters the package adds to
+type recordingMeter struct {
+	noop.Meter
+	counts     map[string]int64
+	errorTypes map[string][]string
+}
+
+func (m *recordingMeter) Int64Counter(name string, options ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return &recordingCounter{meter: m, name: name}, nil
+}
+
+type recordingCounter struct {
+	noop.Int64Counter
+	meter *recordingMeter
+	name  string
+}
+
+func (c *recordingCounter) Add(ctx context.Context, incr int64, options ...metric.AddOption) {
+	c.meter.counts[c.name] += incr
+	attributes := metric.NewAddConfig(options).Attributes()
+	if errorType, ok := attributes.Value("error.type"); ok {
+		c.meter.errorTypes[c.name] = append(c.meter.errorTypes[c.name], errorType.AsString())
+	}
+}
+
+// Counts the transactions begun, committed and rolled back
+type fakeBeginner struct {
+	begun, commits, rollbacks int
+}
+
+func (b *fakeBeginner) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	b.begun++
+	return &fakeTx{beginner: b}, nil
+}
+
+type fakeTx struct {
+	pgx.Tx
+	beginner *fakeBeginner
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.beginner.commits++
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	tx.beginner.rollbacks++
+	return nil
+}
+
+// An error with the SQLSTATE of a serialization failure
+type serializationFailure struct{}
+
+func (serializationFailure) Error() string {
+	return "could not serialize access due to concurrent update"
+}
+
+func (serializationFailure) SQLState() string {
+	return "40001"
+}
+
+// The package is instrumented with -txRetries 2
+func TestRunInTx(t *testing.T) {
+	tests := []struct {
+		name          string
+		fn            func(attempt int) error
+		wantErr       bool
+		wantBegun     int
+		wantCommits   int
+		wantRetries   int64
+		wantErrorType []string
+	}{
+		{"success", func(int) error { return nil }, false, 1, 1, 0, nil},
+		{"retried until the retries are used up", func(int) error { return serializationFailure{} }, true, 3, 0, 2, []string{"serialization_failure", "serialization_failure", "serialization_failure"}},
+		{"retried until it succeeds", func(attempt int) error {
+			if attempt == 1 {
+				return serializationFailure{}
+			}
+			return nil
+		}, false, 2, 1, 1, []string{"serialization_failure"}},
+		{"other errors are not retried", func(int) error { return errors.New("failed") }, true, 1, 0, 0, []string{"other"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			meter := &recordingMeter{counts: map[string]int64{}, errorTypes: map[string][]string{}}
+			q, err := New(nil, meter, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			beginner := &fakeBeginner{}
+			attempt := 0
+			err = q.RunInTx(context.Background(), beginner, pgx.TxOptions{}, func(*Queries) error {
+				attempt++
+				return test.fn(attempt)
+			})
+			if (err != nil) != test.wantErr {
+				t.Errorf("RunInTx() = %v, want error %v", err, test.wantErr)
+			}
+			if beginner.begun != test.wantBegun || beginner.commits != test.wantCommits || beginner.rollbacks != test.wantBegun-test.wantCommits {
+				t.Errorf("begun %d, committed %d, rolled back %d transactions, want %d, %d, %d", beginner.begun, beginner.commits, beginner.rollbacks, test.wantBegun, test.wantCommits, test.wantBegun-test.wantCommits)
+			}
+			if got := meter.counts["sqlc_transaction_retry_counter"]; got != test.wantRetries {
+				t.Errorf("counted %d retries, want %d", got, test.wantRetries)
+			}
+			if got := meter.counts["sqlc_transaction_rollback_counter"]; got != int64(test.wantBegun-test.wantCommits) {
+				t.Errorf("counted %d rollbacks, want %d", got, test.wantBegun-test.wantCommits)
+			}
+			if got := meter.errorTypes["sqlc_transaction_error_counter"]; !slices.Equal(got, test.wantErrorType) {
+				t.Errorf("counted errors %q, want %q", got, test.wantErrorType)
+			}
+		})
+	}
+}
+
+func TestRunInTxPanic(t *testing.T) {
+	meter := &recordingMeter{counts: map[string]int64{}, errorTypes: map[string][]string{}}
+	q, err := New(nil, meter, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	beginner := &fakeBeginner{}
+	defer func() {
+		if p := recover(); p != "fn panicked" {
+			t.Errorf("recovered %v, want the panic of fn", p)
+		}
+		if beginner.rollbacks != 1 || meter.counts["sqlc_transaction_rollback_counter"] != 1 {
+			t.Errorf("rolled back %d transactions and counted %d rollbacks, want 1", beginner.rollbacks, meter.counts["sqlc_transaction_rollback_counter"])
+		}
+		if got := meter.errorTypes["sqlc_transaction_error_counter"]; !slices.Equal(got, []string{"panic"}) {
+			t.Errorf("counted errors %q, want the panic", got)
+		}
+	}()
+	_ = q.RunInTx(context.Background(), beginner, pgx.TxOptions{}, func(*Queries) error {
+		panic("fn panicked")
+	})
+}
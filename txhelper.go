@@ -0,0 +1,189 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// The imports RunInTx uses besides the ones of the sql package
+var txHelperImports = []string{
+	"context",
+	"go.opentelemetry.io/otel/attribute",
+	"go.opentelemetry.io/otel/metric",
+	"sync/atomic",
+	"time",
+}
+
+// The name of the transactions in the metric names, taking the place of the query
+const txMetricName = "transaction"
+
+// The Queries field counting the queries of the transaction the Queries belong to, nil outside of RunInTx
+const txQueriesField = "txQueries"
+
+// Returns the instruments of the transactions, the retry counter only exists if transactions are retried
+func txInstruments(options *packageOptions) []packageInstrument {
+	instruments := []packageInstrument{
+		{"txDurationHistogram", "Float64Histogram", []string{"duration", "histogram"}, "s", "Duration of the transactions run by RunInTx"},
+		{"txQueriesHistogram", "Int64Histogram", []string{"queries", "histogram"}, "{query}", "Queries per transaction run by RunInTx"},
+		{"txCommitCounter", "Int64Counter", []string{"commit", "counter"}, "{transaction}", "Transactions committed by RunInTx"},
+		{"txRollbackCounter", "Int64Counter", []string{"rollback", "counter"}, "{transaction}", "Transactions rolled back by RunInTx"},
+		{"txErrorCounter", "Int64Counter", []string{"error", "counter"}, "{transaction}", "Transactions run by RunInTx that failed"},
+	}
+	if options.txRetries() > 0 {
+		instruments = append(instruments, packageInstrument{"txRetryCounter", "Int64Counter", []string{"retry", "counter"}, "{transaction}", "Transactions retried by RunInTx after a serialization failure"})
+	}
+	return instruments
+}
+
+// RunInTx and the function running a single attempt of the transaction
+var txHelperTemplate = template.Must(template.New("RunInTx").Parse(`package db
+
+func (q *Queries) RunInTx(ctx context.Context, beginner interface {
+	BeginTx(context.Context, {{.TxOptions}}) ({{.Tx}}, error)
+}, opts {{.TxOptions}}, fn func(*Queries) error) error {
+{{- if .Retries}}
+	{{template "attributes" .}}
+	//A transaction that failed with a serialization failure is run again, so fn has to be safe to retry
+	for attempt := 0; ; attempt++ {
+		err := q.runInTx(ctx, beginner, opts, fn)
+		if err == nil || attempt == {{.Retries}} || classifyQueryError(err) != "serialization_failure" {
+			return err
+		}
+		q.txRetryCounter.Add(ctx, 1, {{.Options}})
+	}
+{{- else}}
+	return q.runInTx(ctx, beginner, opts, fn)
+{{- end}}
+}
+
+func (q *Queries) runInTx(ctx context.Context, beginner interface {
+	BeginTx(context.Context, {{.TxOptions}}) ({{.Tx}}, error)
+}, opts {{.TxOptions}}, fn func(*Queries) error) (err error) {
+	{{template "attributes" .}}
+	startTime := time.Now()
+	var queries atomic.Int64
+	defer func() {
+		q.txDurationHistogram.Record(ctx, time.Since(startTime).Seconds(), {{.Options}})
+		q.txQueriesHistogram.Record(ctx, queries.Load(), {{.Options}})
+		if err != nil {
+			q.txErrorCounter.Add(ctx, 1, {{.Options}}, metric.WithAttributes(attribute.String("error.type", classifyQueryError(err))))
+		}
+	}()
+	tx, err := beginner.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			//The panic is counted as a failed transaction before it continues, err is not set while panicking
+			_ = tx.Rollback({{.Ctx}})
+			q.txRollbackCounter.Add(ctx, 1, {{.Options}})
+			q.txErrorCounter.Add(ctx, 1, {{.Options}}, metric.WithAttributes(attribute.String("error.type", "panic")))
+			panic(p)
+		}
+	}()
+	txQueries := q.WithTx(tx)
+	txQueries.txQueries = &queries
+	if fnErr := fn(txQueries); fnErr != nil {
+		//The error of fn tells more than the one of the rollback
+		_ = tx.Rollback({{.Ctx}})
+		q.txRollbackCounter.Add(ctx, 1, {{.Options}})
+		return fnErr
+	}
+	err = tx.Commit({{.Ctx}})
+	if err != nil {
+		return err
+	}
+	q.txCommitCounter.Add(ctx, 1, {{.Options}})
+	return nil
+}
+{{define "attributes"}}attributes := metric.WithAttributes({{.Attributes}})
+{{- if .ContextAttributes}}
+	contextAttributes := metric.WithAttributes(q.attributeExtractor(ctx, "RunInTx")...)
+{{- end}}
+{{- end}}
+`))
+
+// Creates RunInTx and runInTx for the sql package the db file uses
+func createTxHelperFunctions(fset *token.FileSet, file *ast.File, options *packageOptions) ([]ast.Decl, error) {
+	data := struct {
+		TxOptions         string
+		Tx                string
+		Ctx               string
+		Retries           int
+		Attributes        string
+		ContextAttributes bool
+		Options           string
+	}{
+		TxOptions:         "*sql.TxOptions",
+		Tx:                "*sql.Tx",
+		Retries:           options.txRetries(),
+		ContextAttributes: options.attributeExtractor(),
+		Options:           "attributes",
+	}
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if path == "github.com/jackc/pgx/v5" || path == "github.com/jackc/pgx/v4" {
+			data.TxOptions, data.Tx, data.Ctx = "pgx.TxOptions", "pgx.Tx", "ctx"
+		}
+	}
+	data.Attributes = strings.Join(packageAttributes(options), ", ")
+	if data.ContextAttributes {
+		data.Options = "contextAttributes, attributes"
+	}
+	decls, err := parseTemplateDecls(txHelperTemplate, data)
+	if err != nil {
+		return nil, newError(unsupportedError, fset.Position(file.Package), "", "%w", err)
+	}
+	return decls, nil
+}
+
+// Counts the query as part of the transaction run by RunInTx, if the Queries belong to one
+func countTxQuery() ast.Stmt {
+	return &ast.IfStmt{
+		Cond: &ast.BinaryExpr{
+			X: &ast.SelectorExpr{
+				X: &ast.Ident{
+					Name: "q",
+				},
+				Sel: &ast.Ident{
+					Name: txQueriesField,
+				},
+			},
+			Op: token.NEQ,
+			Y: &ast.Ident{
+				Name: "nil",
+			},
+		},
+		Body: &ast.BlockStmt{
+			List: []ast.Stmt{
+				&ast.ExprStmt{
+					X: &ast.CallExpr{
+						Fun: &ast.SelectorExpr{
+							X: &ast.SelectorExpr{
+								X: &ast.Ident{
+									Name: "q",
+								},
+								Sel: &ast.Ident{
+									Name: txQueriesField,
+								},
+							},
+							Sel: &ast.Ident{
+								Name: "Add",
+							},
+						},
+						Args: []ast.Expr{
+							&ast.BasicLit{
+								Kind:  token.INT,
+								Value: "1",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+// Instruments the pgx fixture with RunInTx and runs the tests of testdata/runintx against it, which fake the
+// transactions and record the counters
+func TestRunInTx(t *testing.T) {
+	dir := t.TempDir()
+	copyFixtures(t, dir, "pgx", "module", "runintx")
+	enabled := true
+	//testdata/runintx expects two retries
+	retries := 2
+	runPackage(t, dir, settings{TxHelper: &enabled, TxRetries: &retries}, false)
+	runGo(t, dir, "test", "-count=1", ".")
+}